@@ -0,0 +1,97 @@
+package hue
+
+import "encoding/json"
+
+type BehaviorScriptMetadata struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+type BehaviorScript struct {
+	ID                  string                  `json:"id"`
+	IDv1                string                  `json:"id_v1"`
+	Description         string                  `json:"description,omitempty"`
+	ConfigurationSchema json.RawMessage         `json:"configuration_schema,omitempty"`
+	TriggerSchema       json.RawMessage         `json:"trigger_schema,omitempty"`
+	StateSchema         json.RawMessage         `json:"state_schema,omitempty"`
+	Version             string                  `json:"version,omitempty"`
+	Metadata            *BehaviorScriptMetadata `json:"metadata,omitempty"`
+}
+
+func (_ BehaviorScript) Type() ResourceType { return RTypeBehaviorScript }
+
+type BehaviorInstanceMetadata struct {
+	Name string `json:"name"`
+}
+
+type BehaviorInstance struct {
+	ID            string                    `json:"id"`
+	IDv1          string                    `json:"id_v1"`
+	ScriptID      string                    `json:"script_id,omitempty"`
+	Enabled       *bool                     `json:"enabled,omitempty"`
+	State         json.RawMessage           `json:"state,omitempty"`
+	Configuration json.RawMessage           `json:"configuration,omitempty"`
+	Status        string                    `json:"status,omitempty"`
+	LastError     string                    `json:"last_error,omitempty"`
+	Metadata      *BehaviorInstanceMetadata `json:"metadata,omitempty"`
+}
+
+func (_ BehaviorInstance) Type() ResourceType { return RTypeBehaviorInstance }
+
+type SmartSceneMetadata struct {
+	Name string `json:"name"`
+}
+
+type SmartScene struct {
+	ID             string              `json:"id"`
+	IDv1           string              `json:"id_v1"`
+	Metadata       *SmartSceneMetadata `json:"metadata,omitempty"`
+	Group          *ResourceRef        `json:"group,omitempty"`
+	WeekTimeslots  json.RawMessage     `json:"week_timeslots,omitempty"`
+	ActiveTimeslot json.RawMessage     `json:"active_timeslot,omitempty"`
+	State          string              `json:"state,omitempty"`
+}
+
+func (_ SmartScene) Type() ResourceType { return RTypeSmartScene }
+
+type Entertainment struct {
+	ID         string       `json:"id"`
+	IDv1       string       `json:"id_v1"`
+	Owner      *ResourceRef `json:"owner,omitempty"`
+	Renderer   *bool        `json:"renderer,omitempty"`
+	Proxy      *bool        `json:"proxy,omitempty"`
+	Equalizer  *bool        `json:"equalizer,omitempty"`
+	MaxStreams int          `json:"max_streams,omitempty"`
+}
+
+func (_ Entertainment) Type() ResourceType { return RTypeEntertainment }
+
+type EntertainmentConfigurationMetadata struct {
+	Name string `json:"name"`
+}
+
+type EntertainmentConfiguration struct {
+	ID                string                              `json:"id"`
+	IDv1              string                              `json:"id_v1"`
+	Metadata          *EntertainmentConfigurationMetadata `json:"metadata,omitempty"`
+	ConfigurationType string                              `json:"configuration_type,omitempty"`
+	Status            string                              `json:"status,omitempty"`
+	ActiveStreamer    *ResourceRef                        `json:"active_streamer,omitempty"`
+	LightServices     []ResourceRef                       `json:"light_services,omitempty"`
+}
+
+func (_ EntertainmentConfiguration) Type() ResourceType { return RTypeEntertainmentConfiguration }
+
+type PublicImage struct {
+	ID   string `json:"id"`
+	IDv1 string `json:"id_v1"`
+}
+
+func (_ PublicImage) Type() ResourceType { return RTypePublicImage }
+
+type AuthV1 struct {
+	ID   string `json:"id"`
+	IDv1 string `json:"id_v1"`
+}
+
+func (_ AuthV1) Type() ResourceType { return RTypeAuthV1 }
@@ -0,0 +1,348 @@
+package hue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	subscriptionBuffer = 16
+)
+
+// Change types reported to cache subscribers. ChangeSync is reported to every
+// subscriber after the cache has been reloaded from the bridge, since changes may
+// have been missed.
+const (
+	ChangeAdd    = "add"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	ChangeSync   = "sync"
+)
+
+// Change describes a change to a cached resource.
+type Change struct {
+	Type     string
+	Resource ResourceRef
+	Data     json.RawMessage // The resource after the change; nil if deleted.
+}
+
+type subscription struct {
+	rtype ResourceType
+	id    string
+	ch    chan Change
+}
+
+// Cache is a local mirror of the bridge's resources. It loads every resource on
+// (re)connecting to the event stream, and applies events to the stored resources
+// as JSON merge patches.
+type Cache struct {
+	c   *Client
+	log *slog.Logger
+
+	mu        sync.RWMutex
+	resources map[ResourceType]map[string]json.RawMessage
+
+	subMu   sync.Mutex
+	subs    map[int]*subscription
+	nextSub int
+}
+
+func NewCache(c *Client) *Cache {
+	return &Cache{
+		c:         c,
+		log:       c.log,
+		resources: make(map[ResourceType]map[string]json.RawMessage),
+		subs:      make(map[int]*subscription),
+	}
+}
+
+type resourceHeader struct {
+	ID   string       `json:"id"`
+	Type ResourceType `json:"type"`
+}
+
+// Sync replaces the contents of the cache with the current state of the bridge.
+func (s *Cache) Sync() error {
+	var res Response[json.RawMessage]
+	if err := s.c.get("", &res); err != nil {
+		return err
+	}
+
+	resources := make(map[ResourceType]map[string]json.RawMessage)
+	for _, raw := range res.Data {
+		var header resourceHeader
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return err
+		}
+		if resources[header.Type] == nil {
+			resources[header.Type] = make(map[string]json.RawMessage)
+		}
+		resources[header.Type][header.ID] = raw
+	}
+
+	s.mu.Lock()
+	s.resources = resources
+	s.mu.Unlock()
+
+	s.log.Info("Synchronized resource cache", slog.Int("resources", len(res.Data)))
+
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	for _, sub := range s.subs {
+		s.notify(sub, Change{
+			Type:     ChangeSync,
+			Resource: ResourceRef{ID: sub.id, Type: sub.rtype},
+		})
+	}
+
+	return nil
+}
+
+// Run keeps the cache in sync with the bridge's event stream until ctx is done,
+// reloading it every time the stream (re)connects. Events are forwarded to out
+// after they have been applied, unless out is nil.
+func (s *Cache) Run(ctx context.Context, out chan<- Event) {
+	handle := func(event Event) {
+		s.Apply(event)
+		if out == nil {
+			return
+		}
+		select {
+		case out <- event:
+		case <-ctx.Done():
+		}
+	}
+
+	for {
+		lastEventID, err := s.c.listen(ctx, handle, s.Sync)
+		if ctx.Err() != nil {
+			return
+		}
+		s.log.Error("Error while listening for events. Retrying...",
+			slog.Any("error", err),
+			slog.String("last_event_id", lastEventID),
+			slog.Duration("retry_after", retrySleepDuration),
+		)
+
+		if !sleepContext(ctx, retrySleepDuration) {
+			return
+		}
+	}
+}
+
+// Apply updates the cache with the contents of an event. Updates to resources
+// which aren't cached are ignored, since they only hold the changed fields; the
+// resource is cached on the next Sync.
+func (s *Cache) Apply(event Event) {
+	for _, raw := range event.Raw {
+		var header resourceHeader
+		if err := json.Unmarshal(raw, &header); err != nil {
+			s.log.Error("Error while applying event", slog.Any("error", err))
+			continue
+		}
+
+		change := Change{
+			Type:     event.Type,
+			Resource: ResourceRef{ID: header.ID, Type: header.Type},
+		}
+
+		s.mu.Lock()
+		byID := s.resources[header.Type]
+		if byID == nil {
+			byID = make(map[string]json.RawMessage)
+			s.resources[header.Type] = byID
+		}
+
+		switch event.Type {
+		case ChangeAdd:
+			byID[header.ID] = raw
+			change.Data = raw
+		case ChangeUpdate:
+			current, ok := byID[header.ID]
+			if !ok {
+				s.mu.Unlock()
+				s.log.Debug("Ignoring update to unknown resource",
+					slog.String("type", string(header.Type)),
+					slog.String("id", header.ID),
+				)
+				continue
+			}
+			patched, err := mergePatch(current, raw)
+			if err != nil {
+				s.mu.Unlock()
+				s.log.Error("Error while applying update", slog.Any("error", err))
+				continue
+			}
+			byID[header.ID] = patched
+			change.Data = patched
+		case ChangeDelete:
+			delete(byID, header.ID)
+		default:
+			s.mu.Unlock()
+			s.log.Debug("Ignoring event", slog.String("type", event.Type))
+			continue
+		}
+		s.mu.Unlock()
+
+		s.publish(change)
+	}
+}
+
+// Snapshot returns a consistent view of the cache at the current time.
+func (s *Cache) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Stored messages are replaced rather than modified, so copying the maps is
+	// sufficient.
+	resources := make(map[ResourceType]map[string]json.RawMessage, len(s.resources))
+	for rtype, byID := range s.resources {
+		copied := make(map[string]json.RawMessage, len(byID))
+		for id, raw := range byID {
+			copied[id] = raw
+		}
+		resources[rtype] = copied
+	}
+	return Snapshot{resources: resources}
+}
+
+// Subscribe returns a channel receiving changes to the resource with the given type
+// and ID. If id is empty, changes to every resource of the type are received. The
+// returned function cancels the subscription.
+func (s *Cache) Subscribe(rtype ResourceType, id string) (<-chan Change, func()) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	key := s.nextSub
+	s.nextSub++
+	sub := &subscription{
+		rtype: rtype,
+		id:    id,
+		ch:    make(chan Change, subscriptionBuffer),
+	}
+	s.subs[key] = sub
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			s.subMu.Lock()
+			defer s.subMu.Unlock()
+			delete(s.subs, key)
+			close(sub.ch)
+		})
+	}
+	return sub.ch, cancel
+}
+
+func (s *Cache) publish(change Change) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	for _, sub := range s.subs {
+		if sub.rtype != change.Resource.Type {
+			continue
+		}
+		if sub.id != "" && sub.id != change.Resource.ID {
+			continue
+		}
+		s.notify(sub, change)
+	}
+}
+
+func (s *Cache) notify(sub *subscription, change Change) {
+	select {
+	case sub.ch <- change:
+	default:
+		s.log.Warn("Subscriber is not keeping up, dropping change",
+			slog.String("type", string(change.Resource.Type)),
+			slog.String("id", change.Resource.ID),
+		)
+	}
+}
+
+// Snapshot is an immutable view of the cached resources.
+type Snapshot struct {
+	resources map[ResourceType]map[string]json.RawMessage
+}
+
+// Raw returns the JSON of a resource.
+func (s Snapshot) Raw(rtype ResourceType, id string) (json.RawMessage, bool) {
+	raw, ok := s.resources[rtype][id]
+	return raw, ok
+}
+
+// Lookup returns the resource of type T with the given ID. It returns false if
+// the resource does not exist or could not be decoded.
+func Lookup[T Resource](s Snapshot, id string) (T, bool) {
+	var r T
+	raw, ok := s.Raw(r.Type(), id)
+	if !ok {
+		return r, false
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return r, false
+	}
+	return r, true
+}
+
+// All returns every resource of type T, skipping any that could not be decoded.
+func All[T Resource](s Snapshot) []T {
+	var empty T
+	byID := s.resources[empty.Type()]
+
+	resources := make([]T, 0, len(byID))
+	for _, raw := range byID {
+		var r T
+		if err := json.Unmarshal(raw, &r); err != nil {
+			continue
+		}
+		resources = append(resources, r)
+	}
+	return resources
+}
+
+// mergePatch applies patch to target as described by RFC 7386.
+func mergePatch(target, patch json.RawMessage) (json.RawMessage, error) {
+	var t any
+	if len(target) != 0 {
+		if err := decodeNumbers(target, &t); err != nil {
+			return nil, err
+		}
+	}
+	var p any
+	if err := decodeNumbers(patch, &p); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(applyMergePatch(t, p))
+}
+
+func applyMergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = applyMergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+func decodeNumbers(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,137 @@
+package hue
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{"add key", `{"a":1}`, `{"b":2}`, `{"a":1,"b":2}`},
+		{"replace scalar", `{"a":1}`, `{"a":"x"}`, `{"a":"x"}`},
+		{"null deletes key", `{"a":1,"b":2}`, `{"a":null}`, `{"b":2}`},
+		{"null deletes missing key", `{"a":1}`, `{"b":null}`, `{"a":1}`},
+		{"nested merge", `{"on":{"on":true},"dimming":{"brightness":50,"min_dim_level":1}}`,
+			`{"dimming":{"brightness":20}}`,
+			`{"dimming":{"brightness":20,"min_dim_level":1},"on":{"on":true}}`},
+		{"nested null", `{"a":{"b":1,"c":2}}`, `{"a":{"b":null}}`, `{"a":{"c":2}}`},
+		{"array replaces array", `{"a":[1,2,3]}`, `{"a":[4]}`, `{"a":[4]}`},
+		{"object replaces scalar", `{"a":1}`, `{"a":{"b":2}}`, `{"a":{"b":2}}`},
+		{"scalar replaces object", `{"a":{"b":2}}`, `{"a":3}`, `{"a":3}`},
+		{"non-object patch replaces target", `{"a":1}`, `[1,2]`, `[1,2]`},
+		{"patch into empty target", ``, `{"a":{"b":null,"c":1}}`, `{"a":{"c":1}}`},
+		{"numbers are kept exactly", `{"a":0.1}`, `{"b":12345678901234567890}`, `{"a":0.1,"b":12345678901234567890}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergePatch(json.RawMessage(tt.target), json.RawMessage(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("mergePatch(%s, %s) = %s, want %s", tt.target, tt.patch, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := mergePatch(json.RawMessage(`{"a":1}`), json.RawMessage(`{`)); err == nil {
+		t.Error("mergePatch with an invalid patch succeeded")
+	}
+}
+
+func newTestCache(t *testing.T, resources string) *Cache {
+	b := newFakeBridge(t, func(w http.ResponseWriter, r *http.Request) bool {
+		w.Write([]byte(`{"data": ` + resources + `, "errors": []}`))
+		return true
+	})
+	return NewCache(newTestClient(t, b, RateLimits{}))
+}
+
+func cacheEvent(eventType string, resources ...string) Event {
+	event := Event{Type: eventType}
+	for _, r := range resources {
+		event.Raw = append(event.Raw, json.RawMessage(r))
+	}
+	return event
+}
+
+func TestCacheApply(t *testing.T) {
+	s := newTestCache(t, `[{"id":"l1","type":"light","on":{"on":true},"dimming":{"brightness":50}}]`)
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	changes, cancel := s.Subscribe(RTypeLight, "")
+	defer cancel()
+
+	s.Apply(cacheEvent(ChangeUpdate, `{"id":"l1","type":"light","dimming":{"brightness":20}}`))
+	s.Apply(cacheEvent(ChangeAdd, `{"id":"l2","type":"light","on":{"on":false}}`))
+	s.Apply(cacheEvent(ChangeUpdate, `{"id":"l3","type":"light","on":{"on":true}}`)) // Not cached.
+	s.Apply(cacheEvent(ChangeDelete, `{"id":"l2","type":"light"}`))
+	s.Apply(cacheEvent(ChangeUpdate, `{"id":"s1","type":"scene","status":{"active":"static"}}`))
+
+	want := []struct{ typ, id, data string }{
+		{ChangeUpdate, "l1", `{"dimming":{"brightness":20},"id":"l1","on":{"on":true},"type":"light"}`},
+		{ChangeAdd, "l2", `{"id":"l2","type":"light","on":{"on":false}}`},
+		{ChangeDelete, "l2", ""},
+	}
+	for _, w := range want {
+		c := <-changes
+		if c.Type != w.typ || c.Resource.ID != w.id || string(c.Data) != w.data {
+			t.Errorf("change = %s %s %s, want %s %s %s", c.Type, c.Resource.ID, c.Data, w.typ, w.id, w.data)
+		}
+	}
+	select {
+	case c := <-changes:
+		t.Errorf("unexpected change %s %s", c.Type, c.Resource.ID)
+	default:
+	}
+
+	snapshot := s.Snapshot()
+	if l, ok := Lookup[Light](snapshot, "l1"); !ok || l.Dimming == nil || l.Dimming.Brightness != 20 || l.On == nil || !l.On.On {
+		t.Errorf("l1 = %+v, want on at 20%%", l)
+	}
+	for _, id := range []string{"l2", "l3"} {
+		if _, ok := snapshot.Raw(RTypeLight, id); ok {
+			t.Errorf("%s is cached", id)
+		}
+	}
+	if _, ok := snapshot.Raw(RTypeScene, "s1"); ok {
+		t.Error("partial scene from an update is cached")
+	}
+}
+
+func TestCacheSyncNotifies(t *testing.T) {
+	s := newTestCache(t, `[{"id":"l1","type":"light"},{"id":"s1","type":"scene"}]`)
+	all, cancelAll := s.Subscribe(RTypeLight, "")
+	defer cancelAll()
+	one, cancelOne := s.Subscribe(RTypeScene, "s1")
+	defer cancelOne()
+
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-all; c.Type != ChangeSync || c.Resource != (ResourceRef{Type: RTypeLight}) {
+		t.Errorf("light subscriber got %+v, want a sync", c)
+	}
+	if c := <-one; c.Type != ChangeSync || c.Resource != (ResourceRef{ID: "s1", Type: RTypeScene}) {
+		t.Errorf("scene subscriber got %+v, want a sync of s1", c)
+	}
+	if got := len(All[Light](s.Snapshot())); got != 1 {
+		t.Errorf("%d lights cached, want 1", got)
+	}
+
+	// Cancelling closes the channel, and later syncs skip it.
+	cancelAll()
+	if _, ok := <-all; ok {
+		t.Error("channel not closed after cancelling")
+	}
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
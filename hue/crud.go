@@ -0,0 +1,90 @@
+package hue
+
+import (
+	"golang.org/x/exp/slog"
+)
+
+// Response is the body of a response to a resource request.
+type Response[T any] struct {
+	Errors []HueError `json:"errors"`
+	Data   []T        `json:"data"`
+}
+
+func (r Response[T]) hueErrors() []HueError { return r.Errors }
+
+func typeOf[T Resource]() ResourceType {
+	var r T
+	return r.Type()
+}
+
+func resourceEndpoint(rtype ResourceType, id string) string {
+	if id == "" {
+		return "/" + string(rtype)
+	}
+	return "/" + string(rtype) + "/" + id
+}
+
+// Get fetches a single resource of type T. If the bridge returns no data, the
+// zero value is returned.
+func Get[T Resource](c *Client, id string) (T, error) {
+	var empty T
+	rtype := typeOf[T]()
+
+	var res Response[T]
+	if err := c.get(resourceEndpoint(rtype, id), &res); err != nil {
+		return empty, err
+	}
+	if len(res.Data) == 0 {
+		return empty, nil
+	}
+	if len(res.Data) > 1 {
+		c.log.Warn("got more than one resource",
+			slog.String("type", string(rtype)),
+			slog.String("id", id),
+		)
+	}
+
+	return res.Data[0], nil
+}
+
+// List fetches all resources of type T.
+func List[T Resource](c *Client) ([]T, error) {
+	var res Response[T]
+	if err := c.get(resourceEndpoint(typeOf[T](), ""), &res); err != nil {
+		return nil, err
+	}
+	return res.Data, nil
+}
+
+// Create creates a resource of type T from body, and returns a reference to it.
+func Create[T Resource](c *Client, body any) (ResourceRef, error) {
+	var empty ResourceRef
+	rtype := typeOf[T]()
+
+	var res Response[ResourceRef]
+	if err := c.post(resourceEndpoint(rtype, ""), body, &res); err != nil {
+		return empty, err
+	}
+	if len(res.Data) == 0 {
+		return empty, nil
+	}
+
+	ref := res.Data[0]
+	if ref.Type == "" {
+		ref.Type = rtype
+	}
+	return ref, nil
+}
+
+// Update schedules an update of a resource of type T and waits for it to be sent.
+// Calls may be made concurrently; they are rate limited and coalesced by the
+// client.
+func Update[T Resource](c *Client, id string, body any) error {
+	return <-c.dispatcher.submit(typeOf[T](), id, body)
+}
+
+// Delete deletes the resource with the given type and ID.
+func Delete(c *Client, rtype ResourceType, id string) error {
+	var res Response[ResourceRef]
+	return c.delete(resourceEndpoint(rtype, id), &res)
+}
@@ -0,0 +1,125 @@
+package hue
+
+import "time"
+
+type ProductData struct {
+	ModelID          string `json:"model_id"`
+	ManufacturerName string `json:"manufacturer_name"`
+	ProductName      string `json:"product_name"`
+	ProductArchetype string `json:"product_archetype"`
+	Certified        bool   `json:"certified"`
+	SoftwareVersion  string `json:"software_version"`
+}
+
+type DeviceMetadata struct {
+	Name      string `json:"name"`
+	Archetype string `json:"archetype,omitempty"`
+}
+
+type Device struct {
+	ID          string          `json:"id"`
+	IDv1        string          `json:"id_v1"`
+	ProductData *ProductData    `json:"product_data,omitempty"`
+	Metadata    *DeviceMetadata `json:"metadata,omitempty"`
+	Services    []ResourceRef   `json:"services,omitempty"`
+}
+
+func (_ Device) Type() ResourceType { return RTypeDevice }
+
+type BridgeTimeZone struct {
+	TimeZone string `json:"time_zone"`
+}
+
+type Bridge struct {
+	ID       string          `json:"id"`
+	IDv1     string          `json:"id_v1"`
+	Owner    *ResourceRef    `json:"owner,omitempty"`
+	BridgeID string          `json:"bridge_id,omitempty"`
+	TimeZone *BridgeTimeZone `json:"time_zone,omitempty"`
+}
+
+func (_ Bridge) Type() ResourceType { return RTypeBridge }
+
+type PowerState struct {
+	BatteryState string `json:"battery_state"`
+	BatteryLevel int    `json:"battery_level"`
+}
+
+type DevicePower struct {
+	ID         string       `json:"id"`
+	IDv1       string       `json:"id_v1"`
+	Owner      *ResourceRef `json:"owner,omitempty"`
+	PowerState *PowerState  `json:"power_state,omitempty"`
+}
+
+func (_ DevicePower) Type() ResourceType { return RTypeDevicePower }
+
+type ZigbeeConnectivity struct {
+	ID         string       `json:"id"`
+	IDv1       string       `json:"id_v1"`
+	Owner      *ResourceRef `json:"owner,omitempty"`
+	Status     string       `json:"status,omitempty"`
+	MACAddress string       `json:"mac_address,omitempty"`
+}
+
+func (_ ZigbeeConnectivity) Type() ResourceType { return RTypeZigbeeConnectivity }
+
+type ZigbeeBridgeConnectivity struct {
+	ID     string       `json:"id"`
+	IDv1   string       `json:"id_v1"`
+	Owner  *ResourceRef `json:"owner,omitempty"`
+	Status string       `json:"status,omitempty"`
+}
+
+func (_ ZigbeeBridgeConnectivity) Type() ResourceType { return RTypeZigbeeBridgeConnectivity }
+
+type ZgpConnectivity struct {
+	ID       string       `json:"id"`
+	IDv1     string       `json:"id_v1"`
+	Owner    *ResourceRef `json:"owner,omitempty"`
+	Status   string       `json:"status,omitempty"`
+	SourceID string       `json:"source_id,omitempty"`
+}
+
+func (_ ZgpConnectivity) Type() ResourceType { return RTypeZgpConnectivity }
+
+type ZigbeeDeviceDiscovery struct {
+	ID     string       `json:"id"`
+	IDv1   string       `json:"id_v1"`
+	Owner  *ResourceRef `json:"owner,omitempty"`
+	Status string       `json:"status,omitempty"`
+}
+
+func (_ ZigbeeDeviceDiscovery) Type() ResourceType { return RTypeZigbeeDeviceDiscovery }
+
+type Homekit struct {
+	ID     string `json:"id"`
+	IDv1   string `json:"id_v1"`
+	Status string `json:"status,omitempty"`
+}
+
+func (_ Homekit) Type() ResourceType { return RTypeHomekit }
+
+type Matter struct {
+	ID         string `json:"id"`
+	IDv1       string `json:"id_v1"`
+	MaxFabrics int    `json:"max_fabrics,omitempty"`
+	HasQRCode  bool   `json:"has_qr_code,omitempty"`
+}
+
+func (_ Matter) Type() ResourceType { return RTypeMatter }
+
+type MatterFabricData struct {
+	Label    string `json:"label"`
+	VendorID int    `json:"vendor_id"`
+}
+
+type MatterFabric struct {
+	ID           string            `json:"id"`
+	IDv1         string            `json:"id_v1"`
+	Status       string            `json:"status,omitempty"`
+	FabricData   *MatterFabricData `json:"fabric_data,omitempty"`
+	CreationTime *time.Time        `json:"creation_time,omitempty"`
+}
+
+func (_ MatterFabric) Type() ResourceType { return RTypeMatterFabric }
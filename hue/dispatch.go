@@ -0,0 +1,349 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// ErrClientClosed is returned for updates submitted after the client is shut down.
+var ErrClientClosed = errors.New("hue: client is shut down")
+
+const (
+	defaultConcurrency = 4
+	maxUpdateAttempts  = 4
+	initialBackoff     = 1 * time.Second
+	maxBackoff         = 10 * time.Second
+)
+
+// RateLimit is a token bucket limit: Rate requests per second, with bursts of up
+// to Burst requests.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimits configures how the client schedules resource updates.
+type RateLimits struct {
+	// PerType holds the limit for each resource type, taking precedence over
+	// DefaultRateLimits.PerType. Types listed in neither use Default.
+	PerType map[ResourceType]RateLimit
+	Default RateLimit
+
+	// Concurrency is the maximum number of updates in flight at once.
+	Concurrency int
+}
+
+// DefaultRateLimits follows the bridge's documented guidance of roughly 10 light
+// commands per second and 1 group command per second.
+var DefaultRateLimits = RateLimits{
+	PerType: map[ResourceType]RateLimit{
+		RTypeLight:        {Rate: 10, Burst: 10},
+		RTypeGroupedLight: {Rate: 1, Burst: 1},
+		RTypeScene:        {Rate: 1, Burst: 1},
+	},
+	Default:     RateLimit{Rate: 1, Burst: 1},
+	Concurrency: defaultConcurrency,
+}
+
+// withDefaults fills in the fields which are not set from DefaultRateLimits, and
+// adds the default limits of the types missing from PerType.
+func (l RateLimits) withDefaults() RateLimits {
+	perType := make(map[ResourceType]RateLimit, len(DefaultRateLimits.PerType)+len(l.PerType))
+	for rtype, limit := range DefaultRateLimits.PerType {
+		perType[rtype] = limit
+	}
+	for rtype, limit := range l.PerType {
+		perType[rtype] = limit
+	}
+	l.PerType = perType
+	if l.Default == (RateLimit{}) {
+		l.Default = DefaultRateLimits.Default
+	}
+	if l.Concurrency <= 0 {
+		l.Concurrency = DefaultRateLimits.Concurrency
+	}
+	return l
+}
+
+func (l RateLimits) limit(rtype ResourceType) RateLimit {
+	if limit, ok := l.PerType[rtype]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// wait blocks until a token is available and takes it, or until ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		b.refill(time.Now())
+		if b.tokens >= 1 || b.rate <= 0 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// penalize drains the bucket so that no further requests are made for at least d.
+func (b *tokenBucket) penalize(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens > 0 {
+		b.tokens = 0
+	}
+	b.tokens -= d.Seconds() * b.rate
+}
+
+type pendingUpdate struct {
+	body    any
+	waiters []chan error
+}
+
+// updateQueue holds the pending updates for a single resource type, in the order
+// they were first submitted.
+type updateQueue struct {
+	rtype   ResourceType
+	bucket  *tokenBucket
+	order   []string
+	pending map[string]*pendingUpdate
+	wake    chan struct{}
+}
+
+// dispatcher schedules PUT requests to the bridge. Each resource type has its own
+// rate limit, and all types share a bound on the number of requests in flight.
+// Updates to a resource that has not been sent yet are coalesced, so that only
+// the latest body is sent.
+type dispatcher struct {
+	c      *Client
+	limits RateLimits
+	sem    chan struct{}
+
+	// outstanding counts updates which have been submitted but not completed.
+	outstanding sync.WaitGroup
+
+	mu     sync.Mutex
+	queues map[ResourceType]*updateQueue
+	closed bool
+}
+
+func newDispatcher(c *Client, limits RateLimits) *dispatcher {
+	concurrency := limits.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	return &dispatcher{
+		c:      c,
+		limits: limits,
+		sem:    make(chan struct{}, concurrency),
+		queues: make(map[ResourceType]*updateQueue),
+	}
+}
+
+// submit queues an update of the given resource and returns a channel which
+// receives the result once the update has been sent.
+func (d *dispatcher) submit(rtype ResourceType, id string, body any) <-chan error {
+	done := make(chan error, 1)
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		done <- ErrClientClosed
+		return done
+	}
+
+	q, ok := d.queues[rtype]
+	if !ok {
+		q = &updateQueue{
+			rtype:   rtype,
+			bucket:  newTokenBucket(d.limits.limit(rtype)),
+			pending: make(map[string]*pendingUpdate),
+			wake:    make(chan struct{}, 1),
+		}
+		d.queues[rtype] = q
+		go d.run(q)
+	}
+
+	if p, ok := q.pending[id]; ok {
+		d.c.log.Debug("coalescing update",
+			slog.String("type", string(rtype)),
+			slog.String("id", id),
+		)
+		p.body = body
+		p.waiters = append(p.waiters, done)
+	} else {
+		d.outstanding.Add(1)
+		q.pending[id] = &pendingUpdate{body: body, waiters: []chan error{done}}
+		q.order = append(q.order, id)
+	}
+	d.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return done
+}
+
+// close stops the dispatcher from accepting new updates.
+func (d *dispatcher) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+}
+
+// wait blocks until every submitted update has completed.
+func (d *dispatcher) wait() {
+	d.outstanding.Wait()
+}
+
+func (d *dispatcher) hasPending(q *updateQueue) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(q.order) > 0
+}
+
+func (d *dispatcher) pop(q *updateQueue) (string, *pendingUpdate) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := q.order[0]
+	q.order = q.order[1:]
+	p := q.pending[id]
+	delete(q.pending, id)
+	return id, p
+}
+
+func (d *dispatcher) run(q *updateQueue) {
+	ctx := d.c.ctx
+	for {
+		for !d.hasPending(q) {
+			select {
+			case <-q.wake:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// Wait for capacity before taking the update off the queue, so that
+		// updates submitted in the meantime can still be coalesced.
+		if err := q.bucket.wait(ctx); err != nil {
+			d.fail(q, err)
+			return
+		}
+		select {
+		case d.sem <- struct{}{}:
+		case <-ctx.Done():
+			d.fail(q, ctx.Err())
+			return
+		}
+
+		id, p := d.pop(q)
+		go func() {
+			err := d.send(q, id, p.body)
+			<-d.sem
+			d.complete(p, err)
+		}()
+	}
+}
+
+func (d *dispatcher) complete(p *pendingUpdate, err error) {
+	for _, w := range p.waiters {
+		w <- err
+	}
+	d.outstanding.Done()
+}
+
+// fail completes every pending update in the queue with err.
+func (d *dispatcher) fail(q *updateQueue, err error) {
+	for d.hasPending(q) {
+		_, p := d.pop(q)
+		d.complete(p, err)
+	}
+}
+
+// send performs the update, retrying with backoff while the bridge reports that
+// it is rate limited or busy.
+func (d *dispatcher) send(q *updateQueue, id string, body any) error {
+	endpoint := resourceEndpoint(q.rtype, id)
+	backoff := initialBackoff
+
+	for attempt := 1; ; attempt++ {
+		var res Response[ResourceRef]
+		err := d.c.put(endpoint, body, &res)
+		if err == nil {
+			return nil
+		}
+
+		var hueErr *Error
+		if !errors.As(err, &hueErr) || !hueErr.retryable() || attempt >= maxUpdateAttempts {
+			return err
+		}
+
+		delay := backoff
+		if hueErr.RetryAfter > delay {
+			delay = hueErr.RetryAfter
+		}
+		d.c.log.Warn("bridge throttled request, backing off",
+			slog.String("endpoint", endpoint),
+			slog.Int("status", hueErr.StatusCode),
+			slog.Int("attempt", attempt),
+			slog.Duration("retry_after", delay),
+		)
+		q.bucket.penalize(delay)
+		if err := q.bucket.wait(d.c.ctx); err != nil {
+			return err
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
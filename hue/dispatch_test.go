@@ -0,0 +1,312 @@
+package hue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// request is a PUT received by a fakeBridge.
+type request struct {
+	path string
+	body string
+	time time.Time
+}
+
+// fakeBridge records resource updates, and answers them with respond, or with
+// an empty success if respond is nil.
+type fakeBridge struct {
+	*httptest.Server
+	respond func(w http.ResponseWriter, r *http.Request) bool // Reports whether it responded.
+
+	mu       sync.Mutex
+	requests []request
+}
+
+func newFakeBridge(t *testing.T, respond func(w http.ResponseWriter, r *http.Request) bool) *fakeBridge {
+	b := &fakeBridge{respond: respond}
+	b.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		b.mu.Lock()
+		b.requests = append(b.requests, request{
+			path: strings.TrimPrefix(r.URL.Path, "/clip/v2/resource"),
+			body: string(body),
+			time: time.Now(),
+		})
+		b.mu.Unlock()
+
+		if b.respond != nil && b.respond(w, r) {
+			return
+		}
+		w.Write([]byte(`{"data": [], "errors": []}`))
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+func (b *fakeBridge) received() []request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]request(nil), b.requests...)
+}
+
+func newTestClient(t *testing.T, b *fakeBridge, limits RateLimits) *Client {
+	c := NewClient(slog.New(slog.NewTextHandler(io.Discard, nil)), Config{
+		Addr:   b.Listener.Addr().String(),
+		Limits: limits,
+	})
+	t.Cleanup(func() { c.cancel() })
+	return c
+}
+
+func body(n int) map[string]int {
+	return map[string]int{"n": n}
+}
+
+func bodyString(n int) string {
+	data, _ := json.Marshal(body(n))
+	return string(data)
+}
+
+func TestRateLimitsWithDefaults(t *testing.T) {
+	custom := RateLimit{Rate: 5, Burst: 2}
+	got := RateLimits{Concurrency: 1, Default: custom}.withDefaults()
+	if got.Concurrency != 1 || got.Default != custom {
+		t.Errorf("withDefaults() = %+v, want the caller's concurrency and default kept", got)
+	}
+	if got.limit(RTypeLight) != DefaultRateLimits.PerType[RTypeLight] {
+		t.Errorf("light limit = %+v, want the default", got.limit(RTypeLight))
+	}
+
+	perType := map[ResourceType]RateLimit{RTypeLight: custom, RTypeRoom: custom}
+	got = RateLimits{PerType: perType}.withDefaults()
+	for rtype, want := range map[ResourceType]RateLimit{
+		RTypeLight:        custom,
+		RTypeRoom:         custom,
+		RTypeGroupedLight: DefaultRateLimits.PerType[RTypeGroupedLight],
+		RTypeScene:        DefaultRateLimits.PerType[RTypeScene],
+		RTypeDevice:       DefaultRateLimits.Default,
+	} {
+		if got.limit(rtype) != want {
+			t.Errorf("%s limit = %+v, want %+v", rtype, got.limit(rtype), want)
+		}
+	}
+	if len(perType) != 2 || DefaultRateLimits.PerType[RTypeLight] == custom {
+		t.Error("withDefaults() modified the given or the default limits")
+	}
+	if got.Concurrency != DefaultRateLimits.Concurrency {
+		t.Errorf("concurrency = %d, want the default", got.Concurrency)
+	}
+}
+
+func TestDispatcherCoalescesUpdates(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	b := newFakeBridge(t, func(w http.ResponseWriter, r *http.Request) bool {
+		// Hold the first request, so that later ones queue up behind it.
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		return false
+	})
+	c := newTestClient(t, b, RateLimits{
+		PerType:     map[ResourceType]RateLimit{RTypeLight: {Rate: 1000, Burst: 10}},
+		Concurrency: 1,
+	})
+
+	results := []<-chan error{c.dispatcher.submit(RTypeLight, "a", body(1))}
+	<-started
+	results = append(results,
+		c.dispatcher.submit(RTypeLight, "a", body(2)),
+		c.dispatcher.submit(RTypeLight, "b", body(1)),
+		c.dispatcher.submit(RTypeLight, "a", body(3)),
+	)
+	close(release)
+	for i, result := range results {
+		if err := <-result; err != nil {
+			t.Errorf("update %d: %v", i, err)
+		}
+	}
+
+	want := []request{
+		{path: "/light/a", body: bodyString(1)},
+		{path: "/light/a", body: bodyString(3)},
+		{path: "/light/b", body: bodyString(1)},
+	}
+	got := b.received()
+	if len(got) != len(want) {
+		t.Fatalf("bridge received %d requests, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].path != want[i].path || got[i].body != want[i].body {
+			t.Errorf("request %d = %s %s, want %s %s", i, got[i].path, got[i].body, want[i].path, want[i].body)
+		}
+	}
+}
+
+func TestDispatcherRateLimitsPerType(t *testing.T) {
+	b := newFakeBridge(t, nil)
+	c := newTestClient(t, b, RateLimits{
+		PerType: map[ResourceType]RateLimit{
+			RTypeLight: {Rate: 20, Burst: 2},
+			RTypeScene: {Rate: 5, Burst: 1},
+		},
+		Concurrency: 8,
+	})
+
+	start := time.Now()
+	var results []<-chan error
+	for _, id := range []string{"1", "2", "3", "4", "5", "6"} {
+		results = append(results, c.dispatcher.submit(RTypeLight, id, body(0)))
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		results = append(results, c.dispatcher.submit(RTypeScene, id, body(0)))
+	}
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	times := make(map[string][]time.Time)
+	for _, r := range b.received() {
+		rtype := strings.Split(r.path, "/")[1]
+		times[rtype] = append(times[rtype], r.time)
+	}
+	tests := []struct {
+		rtype string
+		span  time.Duration // Minimum time until the last request, after the burst.
+	}{
+		{"light", 4 * 50 * time.Millisecond},
+		{"scene", 2 * 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		ts := times[tt.rtype]
+		if len(ts) == 0 {
+			t.Errorf("no %s requests", tt.rtype)
+			continue
+		}
+		if span := ts[len(ts)-1].Sub(start); span < tt.span {
+			t.Errorf("%d %s requests took %v, want at least %v", len(ts), tt.rtype, span, tt.span)
+		}
+	}
+	// Scenes don't hold up lights.
+	if last, first := times["light"][len(times["light"])-1], times["scene"][len(times["scene"])-1]; !last.Before(first) {
+		t.Errorf("last light request at %v, after the last scene request at %v", last, first)
+	}
+}
+
+func TestDispatcherRetryAfter(t *testing.T) {
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	b := newFakeBridge(t, func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[r.URL.Path]++
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/busy") && attempts[r.URL.Path] == 1:
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case strings.HasSuffix(r.URL.Path, "/bad"):
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors": [{"description": "invalid body"}]}`))
+		default:
+			return false
+		}
+		return true
+	})
+	c := newTestClient(t, b, RateLimits{
+		PerType: map[ResourceType]RateLimit{RTypeLight: {Rate: 100, Burst: 10}},
+	})
+
+	start := time.Now()
+	if err := c.UpdateLight("busy", LightUpdate{}); err != nil {
+		t.Fatalf("update was not retried: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("retried after %v, want at least the 2s the bridge asked for", elapsed)
+	}
+
+	err := c.UpdateLight("bad", LightUpdate{})
+	var hueErr *Error
+	if !errors.As(err, &hueErr) || hueErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("update = %v, want a 400 error", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts["/clip/v2/resource/light/bad"] != 1 {
+		t.Errorf("sent %d requests for a rejected update, want 1", attempts["/clip/v2/resource/light/bad"])
+	}
+}
+
+func TestShutdownWaitsForUpdates(t *testing.T) {
+	b := newFakeBridge(t, nil)
+	c := newTestClient(t, b, RateLimits{
+		PerType: map[ResourceType]RateLimit{RTypeLight: {Rate: 20, Burst: 1}},
+	})
+
+	var results []<-chan error
+	for _, id := range []string{"1", "2", "3"} {
+		results = append(results, c.dispatcher.submit(RTypeLight, id, body(0)))
+	}
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	for i, result := range results {
+		if err := <-result; err != nil {
+			t.Errorf("update %d: %v", i, err)
+		}
+	}
+	if got := len(b.received()); got != 3 {
+		t.Errorf("bridge received %d requests, want 3", got)
+	}
+
+	if err := c.UpdateLight("4", LightUpdate{}); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("update after Shutdown = %v, want %v", err, ErrClientClosed)
+	}
+}
+
+func TestShutdownCancelsUpdates(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	b := newFakeBridge(t, func(w http.ResponseWriter, r *http.Request) bool {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		return false
+	})
+	c := newTestClient(t, b, RateLimits{
+		PerType:     map[ResourceType]RateLimit{RTypeLight: {Rate: 1000, Burst: 10}},
+		Concurrency: 1,
+	})
+
+	inFlight := c.dispatcher.submit(RTypeLight, "1", body(0))
+	pending := c.dispatcher.submit(RTypeLight, "2", body(0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+	for name, result := range map[string]<-chan error{"in-flight": inFlight, "pending": pending} {
+		select {
+		case err := <-result:
+			if err == nil {
+				t.Errorf("%s update succeeded, want it cancelled", name)
+			}
+		default:
+			t.Errorf("%s update not completed after Shutdown", name)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package hue
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type ErrorResponse struct {
+	Errors []HueError `json:"errors"`
+}
+
+type HueError struct {
+	Description string `json:"description"`
+}
+
+func (e HueError) Error() string {
+	return e.Description
+}
+
+// Error is returned when the bridge rejects a request, either with a non-OK
+// status or with errors listed in the response body.
+type Error struct {
+	Method     string
+	Endpoint   string
+	StatusCode int
+
+	// Errors reported by the bridge in the response body.
+	Errors []HueError
+	// Body holds the raw response body if it did not contain a Hue error list.
+	Body string
+	// RetryAfter is the delay requested by the bridge, if any.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	var msg string
+	switch {
+	case len(e.Errors) != 0:
+		descriptions := make([]string, len(e.Errors))
+		for i, he := range e.Errors {
+			descriptions[i] = he.Description
+		}
+		msg = strings.Join(descriptions, "; ")
+	case e.Body != "":
+		msg = e.Body
+	default:
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("hue: %s %s: status %d: %s", e.Method, e.Endpoint, e.StatusCode, msg)
+}
+
+func (e *Error) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, he := range e.Errors {
+		errs[i] = he
+	}
+	return errs
+}
+
+func (e *Error) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable
+}
+
+func hasStatus(err error, codes ...int) bool {
+	var hueErr *Error
+	if !errors.As(err, &hueErr) {
+		return false
+	}
+	for _, code := range codes {
+		if hueErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotFound reports whether err indicates that the requested resource does not
+// exist, for example because it was deleted.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized reports whether err indicates that the bridge did not accept the
+// application key, and the client needs to be paired again.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized, http.StatusForbidden)
+}
+
+// IsRateLimited reports whether err indicates that too many requests were sent to
+// the bridge.
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// IsBridgeBusy reports whether err indicates that the bridge was temporarily
+// unable to handle the request.
+func IsBridgeBusy(err error) bool {
+	return hasStatus(err, http.StatusServiceUnavailable)
+}
+
+// errorLister is implemented by response bodies that carry a list of errors.
+type errorLister interface {
+	hueErrors() []HueError
+}
@@ -1,6 +1,7 @@
 package hue
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -19,6 +20,7 @@ type Event struct {
 	CreationTime time.Time
 	Type         string
 	Data         []Resource
+	Raw          []json.RawMessage // The undecoded JSON of each element of Data.
 }
 
 type EventFilter func(Event) bool
@@ -43,6 +45,7 @@ func (r *rawEvent) UnmarshalJSON(data []byte) error {
 	r.CreationTime = rawData.CreationTime
 	r.Type = rawData.Type
 	r.Data = nil
+	r.Raw = nil
 
 	for _, msg := range rawData.Data {
 		var obj map[string]any
@@ -62,32 +65,42 @@ func (r *rawEvent) UnmarshalJSON(data []byte) error {
 		}
 		rType := ResourceType(rTypeStr)
 
-		var resource Resource
-		switch rType {
-		case RTypeLight:
-			resource = &Light{}
-		case RTypeScene:
-			resource = &Scene{}
-		default:
-			r.log.Debug("Unknown resource type. Skipping", "type", rType)
-			continue
-		}
-
-		if err := json.Unmarshal(msg, &resource); err != nil {
+		resource, err := decodeResource(rType, msg)
+		if err != nil {
 			return err
 		}
+		if _, ok := resource.(*Unknown); ok {
+			r.log.Debug("Unknown resource type. Keeping raw data", "type", rType)
+		}
 		r.Data = append(r.Data, resource)
+		r.Raw = append(r.Raw, msg)
 	}
 
 	return nil
 }
 
-func (c *Client) EventListener(filter EventFilter, out chan<- Event) {
+// EventListener sends events matching filter to out until ctx is done,
+// reconnecting to the bridge whenever the stream is interrupted.
+func (c *Client) EventListener(ctx context.Context, filter EventFilter, out chan<- Event) {
 	var lastEventId string
 	var err error
 
+	handle := func(event Event) {
+		if !filter(event) {
+			return
+		}
+		select {
+		case out <- event:
+		case <-ctx.Done():
+		}
+	}
+
 	for {
-		lastEventId, err = c.listen(filter, out)
+		lastEventId, err = c.listen(ctx, handle, nil)
+		if ctx.Err() != nil {
+			c.log.Info("Stopped listening for bridge events")
+			return
+		}
 		c.log.Error("Error while listening for events. Retrying...",
 			slog.Any("error", err),
 			slog.String("last_event_id", lastEventId),
@@ -95,16 +108,44 @@ func (c *Client) EventListener(filter EventFilter, out chan<- Event) {
 		)
 		// TODO: Set lastEventID on retry.
 
-		time.Sleep(retrySleepDuration)
+		if !sleepContext(ctx, retrySleepDuration) {
+			return
+		}
+	}
+}
+
+// sleepContext sleeps for d, and reports whether it did so before ctx was done.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
-// Listen to events on http2 stream. Take a callback to use to filter events, and send
-// matching events to a channel
-func (c *Client) listen(filter EventFilter, out chan<- Event) (string, error) {
-	req, _ := http.NewRequest(http.MethodGet, c.absURL("/eventstream/clip/v2"), nil)
-	req.Header.Add(hueAppKeyHeader, c.AppKey)
-	conn := c.sseClient.NewConnection(req)
+// Listen to events on http2 stream until ctx is done, passing each event with data to handle. If
+// onConnect is not nil, it is called once the stream is established and before
+// any events are read; an error aborts the connection.
+func (c *Client) listen(ctx context.Context, handle func(Event), onConnect func() error) (string, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.absURL("/eventstream/clip/v2"), nil)
+	req.Header.Add(hueAppKeyHeader, c.currentAppKey())
+
+	sseClient := *c.sseClient
+	sseClient.ResponseValidator = func(res *http.Response) error {
+		if err := sse.DefaultValidator(res); err != nil {
+			return err
+		}
+		c.connectHook()
+		if onConnect != nil {
+			return onConnect()
+		}
+		return nil
+	}
+	conn := sseClient.NewConnection(req)
 
 	var lastEventID string
 	conn.SubscribeToAll(func(ev sse.Event) {
@@ -132,15 +173,19 @@ func (c *Client) listen(filter EventFilter, out chan<- Event) (string, error) {
 
 			event := raw.Event
 			event.LastEventID = ev.LastEventID
-			if len(event.Data) == 0 || !filter(event) {
+			if len(event.Data) == 0 {
 				continue
 			}
 
-			out <- event
+			c.eventHook(event)
+			handle(event)
 		}
 	})
 
 	c.log.Info("Listening for bridge events")
 	err := conn.Connect()
+	if ctx.Err() == nil {
+		c.disconnectHook(err)
+	}
 	return lastEventID, err
 }
@@ -0,0 +1,45 @@
+package hue
+
+type GroupMetadata struct {
+	Name      string `json:"name"`
+	Archetype string `json:"archetype,omitempty"`
+}
+
+type Room struct {
+	ID       string         `json:"id"`
+	IDv1     string         `json:"id_v1"`
+	Children []ResourceRef  `json:"children,omitempty"`
+	Services []ResourceRef  `json:"services,omitempty"`
+	Metadata *GroupMetadata `json:"metadata,omitempty"`
+}
+
+func (_ Room) Type() ResourceType { return RTypeRoom }
+
+type Zone struct {
+	ID       string         `json:"id"`
+	IDv1     string         `json:"id_v1"`
+	Children []ResourceRef  `json:"children,omitempty"`
+	Services []ResourceRef  `json:"services,omitempty"`
+	Metadata *GroupMetadata `json:"metadata,omitempty"`
+}
+
+func (_ Zone) Type() ResourceType { return RTypeZone }
+
+type BridgeHome struct {
+	ID       string        `json:"id"`
+	IDv1     string        `json:"id_v1"`
+	Children []ResourceRef `json:"children,omitempty"`
+	Services []ResourceRef `json:"services,omitempty"`
+}
+
+func (_ BridgeHome) Type() ResourceType { return RTypeBridgeHome }
+
+type GroupedLight struct {
+	ID      string       `json:"id"`
+	IDv1    string       `json:"id_v1"`
+	Owner   *ResourceRef `json:"owner,omitempty"`
+	On      *LightOn     `json:"on,omitempty"`
+	Dimming *Dimming     `json:"dimming,omitempty"`
+}
+
+func (_ GroupedLight) Type() ResourceType { return RTypeGroupedLight }
@@ -0,0 +1,70 @@
+package hue
+
+import (
+	"strings"
+	"time"
+)
+
+// Hooks observe the client's activity, e.g. to collect metrics. Every hook is
+// optional, and may be called from any goroutine.
+type Hooks struct {
+	// Request is called after each request to the bridge's REST API.
+	Request func(RequestInfo)
+
+	// Connect is called whenever the event stream is established.
+	Connect func()
+
+	// Disconnect is called whenever the event stream is interrupted, before
+	// reconnecting. It is not called once the listener's context is done.
+	Disconnect func(err error)
+
+	// Event is called for every event received, before it is filtered.
+	Event func(Event)
+}
+
+// RequestInfo describes a completed request.
+type RequestInfo struct {
+	Method   string
+	Endpoint string // Path of the request, with resource IDs replaced by "{id}".
+	Status   int    // HTTP status code, or 0 if no response was received.
+	Duration time.Duration
+	Err      error
+}
+
+// endpointPattern replaces the resource ID in a path such as
+// /clip/v2/resource/light/<id>, so that requests can be grouped by endpoint.
+func endpointPattern(path string) string {
+	const prefix = "/clip/v2/resource/"
+	if !strings.HasPrefix(path, prefix) {
+		return path
+	}
+	parts := strings.SplitN(strings.TrimPrefix(path, prefix), "/", 2)
+	if len(parts) == 2 && parts[1] != "" {
+		return prefix + parts[0] + "/{id}"
+	}
+	return path
+}
+
+func (c *Client) requestHook(info RequestInfo) {
+	if c.Hooks.Request != nil {
+		c.Hooks.Request(info)
+	}
+}
+
+func (c *Client) connectHook() {
+	if c.Hooks.Connect != nil {
+		c.Hooks.Connect()
+	}
+}
+
+func (c *Client) disconnectHook(err error) {
+	if c.Hooks.Disconnect != nil {
+		c.Hooks.Disconnect(err)
+	}
+}
+
+func (c *Client) eventHook(event Event) {
+	if c.Hooks.Event != nil {
+		c.Hooks.Event(event)
+	}
+}
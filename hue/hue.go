@@ -2,11 +2,16 @@ package hue
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/tmaxmax/go-sse"
 	"golang.org/x/exp/slog"
@@ -16,29 +21,15 @@ const (
 	hueAppKeyHeader = "hue-application-key"
 )
 
-type ErrorResponse struct {
-	Errors []HueError `json:"errors"`
-}
-
-type HueError struct {
-	Description string `json:"description"`
-}
-
-func (e HueError) Error() string {
-	return e.Description
-}
-
-func joinHueErrors(hueErrors []HueError) error {
-	errs := make([]error, len(hueErrors))
-	for i, e := range hueErrors {
-		errs[i] = e
-	}
-	return errors.Join(errs...)
-}
-
 type Config struct {
 	Addr   string
-	AppKey string
+	AppKey string // Replaced by Client.SetAppKey.
+
+	// Limits controls how resource updates are scheduled. Fields left unset
+	// are taken from DefaultRateLimits.
+	Limits RateLimits
+
+	Hooks Hooks
 }
 
 type Client struct {
@@ -47,21 +38,78 @@ type Client struct {
 	log        *slog.Logger
 	httpClient *http.Client
 	sseClient  *sse.Client
+	dispatcher *dispatcher
+
+	keyMu sync.Mutex // Guards Config.AppKey.
+
+	// ctx is used for every request made by the client, and is cancelled when
+	// the client is shut down.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func NewClient(log *slog.Logger, config Config) *Client {
+func newHTTPClient() *http.Client {
 	// Skip certificate verification. TODO: Make this work properly.
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	httpClient := &http.Client{Transport: transport}
+	return &http.Client{Transport: transport}
+}
+
+func NewClient(log *slog.Logger, config Config) *Client {
+	httpClient := newHTTPClient()
 
 	sseClient := &sse.Client{HTTPClient: httpClient}
 
-	return &Client{
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
 		Config:     config,
 		log:        log,
 		httpClient: httpClient,
 		sseClient:  sseClient,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	c.dispatcher = newDispatcher(c, config.Limits.withDefaults())
+	return c
+}
+
+// SetAppKey replaces the application key sent with later requests, e.g. after
+// pairing with the bridge again, and returns the previous key. The event stream
+// uses it once it reconnects.
+func (c *Client) SetAppKey(key string) (previous string) {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	previous, c.AppKey = c.AppKey, key
+	return previous
+}
+
+func (c *Client) currentAppKey() string {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	return c.AppKey
+}
+
+// Shutdown stops the client from accepting new updates, and waits for pending
+// and in-flight updates to be sent. If ctx is done first, outstanding requests
+// are cancelled. The client cannot be used after Shutdown.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.dispatcher.close()
+
+	done := make(chan struct{})
+	go func() {
+		c.dispatcher.wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		c.cancel()
+		return nil
+	case <-ctx.Done():
+		c.log.Warn("cancelling outstanding requests")
+		c.cancel()
+		<-done
+		return ctx.Err()
 	}
 }
 
@@ -74,7 +122,7 @@ func (c *Client) resourceURL(endpoint string) string {
 }
 
 func (c *Client) get(endpoint string, response any) error {
-	req, err := http.NewRequest(http.MethodGet, c.resourceURL(endpoint), nil)
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.resourceURL(endpoint), nil)
 	if err != nil {
 		return err
 	}
@@ -82,26 +130,56 @@ func (c *Client) get(endpoint string, response any) error {
 }
 
 func (c *Client) put(endpoint string, body any, response any) error {
+	return c.send(http.MethodPut, endpoint, body, response)
+}
+
+func (c *Client) post(endpoint string, body any, response any) error {
+	return c.send(http.MethodPost, endpoint, body, response)
+}
+
+func (c *Client) delete(endpoint string, response any) error {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodDelete, c.resourceURL(endpoint), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, response)
+}
+
+func (c *Client) send(method string, endpoint string, body any, response any) error {
 	bodyJson, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
 	bodyReader := bytes.NewReader(bodyJson)
 
-	req, err := http.NewRequest(http.MethodPut, c.resourceURL(endpoint), bodyReader)
+	req, err := http.NewRequestWithContext(c.ctx, method, c.resourceURL(endpoint), bodyReader)
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/json")
 	return c.do(req, response)
 }
 
-func (c *Client) do(req *http.Request, response any) error {
-	req.Header.Add(hueAppKeyHeader, c.AppKey)
+func (c *Client) do(req *http.Request, response any) (err error) {
+	start := time.Now()
+	status := 0
+	defer func() {
+		c.requestHook(RequestInfo{
+			Method:   req.Method,
+			Endpoint: endpointPattern(req.URL.Path),
+			Status:   status,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+	}()
+
+	req.Header.Add(hueAppKeyHeader, c.currentAppKey())
 	res, err := c.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
+	status = res.StatusCode
 
 	c.log.Debug("request complete",
 		slog.String("status", res.Status),
@@ -109,21 +187,49 @@ func (c *Client) do(req *http.Request, response any) error {
 		slog.String("method", req.Method),
 	)
 
-	dec := json.NewDecoder(res.Body)
 	if res.StatusCode != http.StatusOK {
+		err := &Error{
+			Method:     req.Method,
+			Endpoint:   req.URL.Path,
+			StatusCode: res.StatusCode,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+		body, _ := io.ReadAll(res.Body)
 		var errResp ErrorResponse
-		if err := dec.Decode(&errResp); err != nil {
-			return err
+		if json.Unmarshal(body, &errResp) == nil && len(errResp.Errors) != 0 {
+			err.Errors = errResp.Errors
+		} else {
+			err.Body = strings.TrimSpace(string(body))
 		}
-		err := joinHueErrors(errResp.Errors)
 
 		c.log.Error("request error", slog.Any("error", err))
 		return err
 	}
 
-	if err := dec.Decode(response); err != nil {
-		return err
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		return fmt.Errorf("hue: %s %s: decoding response: %w", req.Method, req.URL.Path, err)
+	}
+	if r, ok := response.(errorLister); ok && len(r.hueErrors()) != 0 {
+		return &Error{
+			Method:     req.Method,
+			Endpoint:   req.URL.Path,
+			StatusCode: res.StatusCode,
+			Errors:     r.hueErrors(),
+		}
 	}
 
 	return nil
 }
+
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
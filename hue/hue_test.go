@@ -0,0 +1,36 @@
+package hue
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestSetAppKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	b := newFakeBridge(t, func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, r.Header.Get(hueAppKeyHeader))
+		return false
+	})
+	c := newTestClient(t, b, RateLimits{})
+	c.SetAppKey("old")
+	if _, err := c.GetLights(); err != nil {
+		t.Fatal(err)
+	}
+	if previous := c.SetAppKey("new"); previous != "old" {
+		t.Errorf("SetAppKey returned %q, want the old key", previous)
+	}
+	if _, err := c.GetLights(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys[0] != "old" || keys[1] != "new" {
+		t.Errorf("sent keys %v, want old then new", keys)
+	}
+	if c.AppKey != "new" {
+		t.Errorf("Config.AppKey = %q, want the new key", c.AppKey)
+	}
+}
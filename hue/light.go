@@ -9,9 +9,10 @@ type Dimming struct {
 	MinDimLevel float64 `json:"min_dim_level"`
 }
 
+// XY is a color in the CIE 1931 color space.
 type XY struct {
-	x float64
-	y float64
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
 }
 
 type Gamut struct {
@@ -54,30 +55,22 @@ type Light struct {
 
 func (_ Light) Type() ResourceType { return RTypeLight }
 
-type GetLightsResponse struct {
-	Errors []HueError `json:"errors"`
-	Data   []Light    `json:"data"`
-}
-
 func (c *Client) GetLights() ([]Light, error) {
-	var res GetLightsResponse
-	if err := c.get("/light", &res); err != nil {
-		return nil, err
-	}
-	if len(res.Errors) != 0 {
-		return nil, joinHueErrors(res.Errors)
-	}
-
-	return res.Data, nil
+	return List[Light](c)
 }
 
 type LightUpdate struct {
 	On               *LightOn                `json:"on,omitempty"`
+	Color            *ColorUpdate            `json:"color,omitempty"`
 	ColorTemperature *ColorTemperatureUpdate `json:"color_temperature,omitempty"`
 	Dimming          *DimmingUpdate          `json:"dimming,omitempty"`
 	Dynamics         *Dynamics               `json:"dynamics,omitempty"`
 }
 
+type ColorUpdate struct {
+	XY XY `json:"xy"`
+}
+
 type ColorTemperatureUpdate struct {
 	Mirek int `json:"mirek"`
 }
@@ -90,19 +83,8 @@ type Dynamics struct {
 	DurationMs int `json:"duration"`
 }
 
-type UpdateLightResponse struct {
-	Errors []HueError    `json:"errors"`
-	Data   []ResourceRef `json:"data"`
-}
-
+// UpdateLight schedules an update of the light and waits for it to be sent. Calls
+// may be made concurrently; they are rate limited and coalesced by the client.
 func (c *Client) UpdateLight(ID string, update LightUpdate) error {
-	var res UpdateLightResponse
-	if err := c.put("/light/"+ID, update, &res); err != nil {
-		return err
-	}
-	if len(res.Errors) != 0 {
-		return joinHueErrors(res.Errors)
-	}
-
-	return nil
+	return Update[Light](c, ID, update)
 }
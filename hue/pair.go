@@ -0,0 +1,105 @@
+package hue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	discoveryURL = "https://discovery.meethue.com/"
+
+	linkButtonNotPressed = 101
+)
+
+// ErrLinkButtonNotPressed is returned by Pair until the bridge's link button has
+// been pressed.
+var ErrLinkButtonNotPressed = errors.New("link button not pressed")
+
+// Credentials are issued by the bridge when pairing a new application.
+type Credentials struct {
+	Username  string `json:"username"` // Used as the application key.
+	ClientKey string `json:"clientkey"`
+}
+
+type pairResponse struct {
+	Success *Credentials `json:"success"`
+	Error   *struct {
+		Type        int    `json:"type"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// Pair registers a new application with the bridge at addr, identified by
+// deviceType (e.g. "timelight#host"). The bridge's link button must have been
+// pressed shortly before; otherwise ErrLinkButtonNotPressed is returned.
+func Pair(addr string, deviceType string) (Credentials, error) {
+	var creds Credentials
+
+	body, err := json.Marshal(map[string]any{
+		"devicetype":        deviceType,
+		"generateclientkey": true,
+	})
+	if err != nil {
+		return creds, err
+	}
+
+	url := fmt.Sprintf("https://%s/api", addr)
+	res, err := newHTTPClient().Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return creds, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return creds, &Error{Method: http.MethodPost, Endpoint: "/api", StatusCode: res.StatusCode}
+	}
+
+	var pairRes []pairResponse
+	if err := json.NewDecoder(res.Body).Decode(&pairRes); err != nil {
+		return creds, err
+	}
+	if len(pairRes) == 0 {
+		return creds, errors.New("empty response from bridge")
+	}
+
+	r := pairRes[0]
+	switch {
+	case r.Error != nil && r.Error.Type == linkButtonNotPressed:
+		return creds, ErrLinkButtonNotPressed
+	case r.Error != nil:
+		return creds, errors.New(r.Error.Description)
+	case r.Success == nil:
+		return creds, errors.New("unexpected response from bridge")
+	}
+
+	return *r.Success, nil
+}
+
+// DiscoveredBridge is a bridge found on the local network.
+type DiscoveredBridge struct {
+	ID   string `json:"id"`
+	Addr string `json:"internalipaddress"`
+	Port int    `json:"port"`
+}
+
+// Discover finds bridges on the local network using the Hue discovery service.
+func Discover() ([]DiscoveredBridge, error) {
+	res, err := http.Get(discoveryURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery service returned %s", res.Status)
+	}
+
+	var bridges []DiscoveredBridge
+	if err := json.NewDecoder(res.Body).Decode(&bridges); err != nil {
+		return nil, err
+	}
+	return bridges, nil
+}
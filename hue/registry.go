@@ -0,0 +1,110 @@
+package hue
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// NewResourceFunc returns a pointer to an empty resource, which JSON is decoded
+// into.
+type NewResourceFunc func() Resource
+
+var registry = struct {
+	sync.RWMutex
+	types map[ResourceType]NewResourceFunc
+}{
+	types: map[ResourceType]NewResourceFunc{
+		RTypeDevice:                     func() Resource { return &Device{} },
+		RTypeBridgeHome:                 func() Resource { return &BridgeHome{} },
+		RTypeRoom:                       func() Resource { return &Room{} },
+		RTypeZone:                       func() Resource { return &Zone{} },
+		RTypeLight:                      func() Resource { return &Light{} },
+		RTypeButton:                     func() Resource { return &Button{} },
+		RTypeRelativeRotary:             func() Resource { return &RelativeRotary{} },
+		RTypeTemperature:                func() Resource { return &Temperature{} },
+		RTypeLightLevel:                 func() Resource { return &LightLevel{} },
+		RTypeMotion:                     func() Resource { return &Motion{} },
+		RTypeEntertainment:              func() Resource { return &Entertainment{} },
+		RTypeGroupedLight:               func() Resource { return &GroupedLight{} },
+		RTypeDevicePower:                func() Resource { return &DevicePower{} },
+		RTypeZigbeeBridgeConnectivity:   func() Resource { return &ZigbeeBridgeConnectivity{} },
+		RTypeZigbeeConnectivity:         func() Resource { return &ZigbeeConnectivity{} },
+		RTypeZgpConnectivity:            func() Resource { return &ZgpConnectivity{} },
+		RTypeBridge:                     func() Resource { return &Bridge{} },
+		RTypeZigbeeDeviceDiscovery:      func() Resource { return &ZigbeeDeviceDiscovery{} },
+		RTypeHomekit:                    func() Resource { return &Homekit{} },
+		RTypeMatter:                     func() Resource { return &Matter{} },
+		RTypeMatterFabric:               func() Resource { return &MatterFabric{} },
+		RTypeScene:                      func() Resource { return &Scene{} },
+		RTypeEntertainmentConfiguration: func() Resource { return &EntertainmentConfiguration{} },
+		RTypePublicImage:                func() Resource { return &PublicImage{} },
+		RTypeAuthV1:                     func() Resource { return &AuthV1{} },
+		RTypeBehaviorScript:             func() Resource { return &BehaviorScript{} },
+		RTypeBehaviorInstance:           func() Resource { return &BehaviorInstance{} },
+		RTypeGeofence:                   func() Resource { return &Geofence{} },
+		RTypeGeofenceClient:             func() Resource { return &GeofenceClient{} },
+		RTypeGeolocation:                func() Resource { return &Geolocation{} },
+		RTypeSmartScene:                 func() Resource { return &SmartScene{} },
+	},
+}
+
+// RegisterResource sets the function used to create resources of the given type
+// when decoding events, replacing any existing registration. It is safe to call
+// concurrently with event decoding.
+func RegisterResource(rtype ResourceType, newResource NewResourceFunc) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.types[rtype] = newResource
+}
+
+// decodeResource decodes a resource of the given type. Types without a registered
+// decoder are decoded as Unknown.
+func decodeResource(rtype ResourceType, data []byte) (Resource, error) {
+	registry.RLock()
+	newResource, ok := registry.types[rtype]
+	registry.RUnlock()
+
+	var resource Resource
+	if ok {
+		resource = newResource()
+	} else {
+		resource = &Unknown{}
+	}
+
+	if err := json.Unmarshal(data, resource); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// Unknown is a resource of a type with no registered decoder. It keeps the raw
+// JSON of the resource.
+type Unknown struct {
+	ID    string
+	RType ResourceType
+	Raw   json.RawMessage
+}
+
+func (u Unknown) Type() ResourceType { return u.RType }
+
+func (u *Unknown) UnmarshalJSON(data []byte) error {
+	var header struct {
+		ID   string       `json:"id"`
+		Type ResourceType `json:"type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+
+	u.ID = header.ID
+	u.RType = header.Type
+	u.Raw = append(u.Raw[:0], data...)
+	return nil
+}
+
+func (u Unknown) MarshalJSON() ([]byte, error) {
+	if len(u.Raw) == 0 {
+		return []byte("null"), nil
+	}
+	return u.Raw, nil
+}
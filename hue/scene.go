@@ -1,7 +1,5 @@
 package hue
 
-import "golang.org/x/exp/slog"
-
 type Scene struct {
 	ID       string        `json:"id"`
 	IDv1     string        `json:"id_v1"`
@@ -44,62 +42,40 @@ type ColorTemperatureAction struct {
 }
 
 type SceneMetadata struct {
-	Name string `json:"name"`
-}
-
-type GetScenesResponse struct {
-	Errors []HueError `json:"errors"`
-	Data   []Scene    `json:"data"`
+	Name    string `json:"name"`
+	AppData string `json:"appdata,omitempty"`
 }
 
 func (c *Client) GetScenes() ([]Scene, error) {
-	var res GetScenesResponse
-	if err := c.get("/scene", &res); err != nil {
-		return nil, err
-	}
-	if len(res.Errors) != 0 {
-		return nil, joinHueErrors(res.Errors)
-	}
-
-	return res.Data, nil
+	return List[Scene](c)
 }
 
 func (c *Client) GetScene(id string) (Scene, error) {
-	var emptyScene Scene
-	var res GetScenesResponse
-	if err := c.get("/scene/"+id, &res); err != nil {
-		return emptyScene, err
-	}
-	if len(res.Errors) != 0 {
-		return emptyScene, joinHueErrors(res.Errors)
-	}
-	if len(res.Data) == 0 {
-		return emptyScene, nil
-	}
-	if len(res.Data) > 1 {
-		c.log.Warn("got more than one scene", slog.String("id", id))
-	}
-
-	return res.Data[0], nil
+	return Get[Scene](c, id)
 }
 
 type SceneUpdate struct {
 	Actions *[]SceneAction `json:"actions,omitempty"`
 }
 
-type UpdateSceneResponse struct {
-	Errors []HueError    `json:"errors"`
-	Data   []ResourceRef `json:"data"`
+// UpdateScene schedules an update of the scene and waits for it to be sent. Calls
+// may be made concurrently; they are rate limited and coalesced by the client.
+func (c *Client) UpdateScene(ID string, update SceneUpdate) error {
+	return Update[Scene](c, ID, update)
 }
 
-func (c *Client) UpdateScene(ID string, update SceneUpdate) error {
-	var res UpdateSceneResponse
-	if err := c.put("/scene/"+ID, update, &res); err != nil {
-		return err
-	}
-	if len(res.Errors) != 0 {
-		return joinHueErrors(res.Errors)
-	}
-
-	return nil
+type SceneCreate struct {
+	Type     ResourceType  `json:"type"`
+	Metadata SceneMetadata `json:"metadata"`
+	Group    ResourceRef   `json:"group"`
+	Actions  []SceneAction `json:"actions"`
+}
+
+func (c *Client) CreateScene(scene SceneCreate) (ResourceRef, error) {
+	scene.Type = RTypeScene
+	return Create[Scene](c, scene)
+}
+
+func (c *Client) DeleteScene(ID string) error {
+	return Delete(c, RTypeScene, ID)
 }
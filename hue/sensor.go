@@ -0,0 +1,149 @@
+package hue
+
+import "time"
+
+type ButtonMetadata struct {
+	ControlID int `json:"control_id"`
+}
+
+// Button events reported in ButtonState.LastEvent.
+const (
+	ButtonInitialPress = "initial_press"
+	ButtonRepeat       = "repeat"
+	ButtonShortRelease = "short_release"
+	ButtonLongPress    = "long_press"
+	ButtonLongRelease  = "long_release"
+)
+
+type ButtonReport struct {
+	Updated time.Time `json:"updated"`
+	Event   string    `json:"event"`
+}
+
+type ButtonState struct {
+	LastEvent      string        `json:"last_event,omitempty"`
+	ButtonReport   *ButtonReport `json:"button_report,omitempty"`
+	RepeatInterval int           `json:"repeat_interval,omitempty"`
+}
+
+type Button struct {
+	ID       string          `json:"id"`
+	IDv1     string          `json:"id_v1"`
+	Owner    *ResourceRef    `json:"owner,omitempty"`
+	Metadata *ButtonMetadata `json:"metadata,omitempty"`
+	Button   *ButtonState    `json:"button,omitempty"`
+}
+
+func (_ Button) Type() ResourceType { return RTypeButton }
+
+type Rotation struct {
+	Direction  string `json:"direction"` // "clock_wise" or "counter_clock_wise"
+	Steps      int    `json:"steps"`
+	DurationMs int    `json:"duration"`
+}
+
+type RotaryEvent struct {
+	Action   string    `json:"action"` // "start" or "repeat"
+	Rotation *Rotation `json:"rotation,omitempty"`
+}
+
+type RotaryReport struct {
+	Updated  time.Time `json:"updated"`
+	Action   string    `json:"action"`
+	Rotation *Rotation `json:"rotation,omitempty"`
+}
+
+type RelativeRotaryState struct {
+	LastEvent    *RotaryEvent  `json:"last_event,omitempty"`
+	RotaryReport *RotaryReport `json:"rotary_report,omitempty"`
+}
+
+type RelativeRotary struct {
+	ID             string               `json:"id"`
+	IDv1           string               `json:"id_v1"`
+	Owner          *ResourceRef         `json:"owner,omitempty"`
+	RelativeRotary *RelativeRotaryState `json:"relative_rotary,omitempty"`
+}
+
+func (_ RelativeRotary) Type() ResourceType { return RTypeRelativeRotary }
+
+type MotionReport struct {
+	Changed time.Time `json:"changed"`
+	Motion  bool      `json:"motion"`
+}
+
+type MotionState struct {
+	Motion       bool          `json:"motion"`
+	MotionValid  bool          `json:"motion_valid"`
+	MotionReport *MotionReport `json:"motion_report,omitempty"`
+}
+
+type Motion struct {
+	ID      string       `json:"id"`
+	IDv1    string       `json:"id_v1"`
+	Owner   *ResourceRef `json:"owner,omitempty"`
+	Enabled *bool        `json:"enabled,omitempty"`
+	Motion  *MotionState `json:"motion,omitempty"`
+}
+
+func (_ Motion) Type() ResourceType { return RTypeMotion }
+
+type TemperatureState struct {
+	Temperature      float64 `json:"temperature"`
+	TemperatureValid bool    `json:"temperature_valid"`
+}
+
+type Temperature struct {
+	ID          string            `json:"id"`
+	IDv1        string            `json:"id_v1"`
+	Owner       *ResourceRef      `json:"owner,omitempty"`
+	Enabled     *bool             `json:"enabled,omitempty"`
+	Temperature *TemperatureState `json:"temperature,omitempty"`
+}
+
+func (_ Temperature) Type() ResourceType { return RTypeTemperature }
+
+type LightLevelState struct {
+	LightLevel      int  `json:"light_level"`
+	LightLevelValid bool `json:"light_level_valid"`
+}
+
+type LightLevel struct {
+	ID      string           `json:"id"`
+	IDv1    string           `json:"id_v1"`
+	Owner   *ResourceRef     `json:"owner,omitempty"`
+	Enabled *bool            `json:"enabled,omitempty"`
+	Light   *LightLevelState `json:"light,omitempty"`
+}
+
+func (_ LightLevel) Type() ResourceType { return RTypeLightLevel }
+
+type Geofence struct {
+	ID   string `json:"id"`
+	IDv1 string `json:"id_v1"`
+	Name string `json:"name,omitempty"`
+}
+
+func (_ Geofence) Type() ResourceType { return RTypeGeofence }
+
+type GeofenceClient struct {
+	ID   string `json:"id"`
+	IDv1 string `json:"id_v1"`
+	Name string `json:"name,omitempty"`
+}
+
+func (_ GeofenceClient) Type() ResourceType { return RTypeGeofenceClient }
+
+type SunToday struct {
+	SunsetTime string `json:"sunset_time"`
+	DayType    string `json:"day_type"`
+}
+
+type Geolocation struct {
+	ID           string    `json:"id"`
+	IDv1         string    `json:"id_v1"`
+	IsConfigured *bool     `json:"is_configured,omitempty"`
+	SunToday     *SunToday `json:"sun_today,omitempty"`
+}
+
+func (_ Geolocation) Type() ResourceType { return RTypeGeolocation }
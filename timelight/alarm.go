@@ -0,0 +1,298 @@
+package timelight
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultAlarmDuration = 30 * time.Minute
+	alarmStartBrightness = 1
+	holidayLayout        = "2006-01-02"
+)
+
+var (
+	errAlarmNotFound = errors.New("alarm not found")
+	errNoAlarm       = errors.New("no upcoming alarm")
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// AlarmConfig wakes someone up by ramping the lights in some rooms from off to
+// the schedule's target at Time, starting Duration earlier. Once the alarm
+// time is reached the lights follow the schedule again.
+//
+// The next ring can be skipped through the API, the skip_alarm MQTT command, or
+// a button bound to the skip_alarm action.
+type AlarmConfig struct {
+	Name  string   `toml:"name"`  // Used to skip the alarm.
+	Rooms []string `toml:"rooms"` // Names of rooms, matched case-insensitively.
+
+	Time     string   `toml:"time"`     // Time of day the lights reach the target, e.g. "07:00".
+	Days     []string `toml:"days"`     // e.g. ["mon", "tue"]; every day if empty.
+	Duration string   `toml:"duration"` // How long the lights take to ramp up; 30 minutes if empty.
+
+	// OnHolidays also rings the alarm on the dates in Config.Holidays.
+	OnHolidays bool `toml:"on_holidays"`
+}
+
+func (c AlarmConfig) duration() time.Duration {
+	return parsePositiveDuration(c.Duration, defaultAlarmDuration)
+}
+
+func (c AlarmConfig) onDay(day time.Weekday) bool {
+	if len(c.Days) == 0 {
+		return true
+	}
+	for _, d := range c.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the end of the alarm's next ramp which ends after now, or the
+// zero time if the alarm never rings.
+func (c AlarmConfig) next(now time.Time, holidays []string) time.Time {
+	minute, err := parseMinuteOfDay(c.Time)
+	if err != nil {
+		return time.Time{}
+	}
+	y, m, d := now.Date()
+	// Each holiday can push a weekly alarm back by a week.
+	for i := 0; i <= 7*(len(holidays)+1); i++ {
+		wake := time.Date(y, m, d+i, minute/60, minute%60, 0, 0, now.Location())
+		if !wake.After(now) || !c.onDay(wake.Weekday()) {
+			continue
+		}
+		if !c.OnHolidays && contains(holidays, wake.Format(holidayLayout)) {
+			continue
+		}
+		return wake
+	}
+	return time.Time{}
+}
+
+func (c AlarmConfig) validate(ps *Problems, key string) {
+	if c.Name == "" {
+		ps.errorf(key+".name", "name is required")
+	}
+	if len(c.Rooms) == 0 {
+		ps.errorf(key+".rooms", "at least one room is required")
+	}
+	if _, err := parseMinuteOfDay(c.Time); err != nil {
+		ps.errorf(key+".time", "%v", err)
+	}
+	for _, d := range c.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			ps.errorf(key+".days", "unknown day %q; use e.g. \"mon\"", d)
+		}
+	}
+	if c.Duration != "" {
+		if d, err := time.ParseDuration(c.Duration); err != nil || d <= 0 {
+			ps.errorf(key+".duration", "invalid duration %q", c.Duration)
+		} else if d > 24*time.Hour {
+			ps.errorf(key+".duration", "must not be longer than a day")
+		}
+	}
+}
+
+// alarmState tracks an alarm between runs of checkAlarms.
+type alarmState struct {
+	rang    time.Time // Wake time of the last ramp that was started.
+	skipped time.Time // Wake time of the ramp to skip.
+}
+
+// Alarm describes an alarm in the API.
+type Alarm struct {
+	Name    string    `json:"name"`
+	Rooms   []string  `json:"rooms"`
+	Next    time.Time `json:"next"`
+	Skipped bool      `json:"skipped"`
+	Ringing bool      `json:"ringing"`
+}
+
+// Alarms returns the configured alarms, sorted by name.
+func (t *Timelight) Alarms(now time.Time) []Alarm {
+	alarms := make([]Alarm, 0, len(t.config.Alarms))
+	for _, c := range t.config.Alarms {
+		state := t.alarms[c.Name]
+		next := c.next(now, t.config.Holidays)
+		alarms = append(alarms, Alarm{
+			Name:    c.Name,
+			Rooms:   c.Rooms,
+			Next:    next,
+			Skipped: !next.IsZero() && next.Equal(state.skipped),
+			Ringing: !next.IsZero() && next.Equal(state.rang) && !next.Equal(state.skipped),
+		})
+	}
+	sort.Slice(alarms, func(i, j int) bool { return alarms[i].Name < alarms[j].Name })
+	return alarms
+}
+
+// SkipAlarm skips the next ring of the named alarm, or of every alarm if name is
+// empty. Lights which are already ramping up are turned off.
+func (t *Timelight) SkipAlarm(now time.Time, name string) error {
+	var skipped int
+	for _, c := range t.config.Alarms {
+		if name != "" && !strings.EqualFold(c.Name, name) {
+			continue
+		}
+		next := c.next(now, t.config.Holidays)
+		if next.IsZero() {
+			continue
+		}
+		state := t.alarms[c.Name]
+		state.skipped = next
+		t.alarms[c.Name] = state
+		skipped++
+
+		if next.Equal(state.rang) {
+			t.stopWaking(now, c)
+		}
+		t.log.Info("skipping alarm", slog.String("alarm", c.Name), slog.Time("wake", next))
+	}
+	if skipped == 0 {
+		if name == "" {
+			return errNoAlarm
+		}
+		return fmt.Errorf("%w: %s", errAlarmNotFound, name)
+	}
+	return nil
+}
+
+// UnskipAlarm undoes SkipAlarm, unless the alarm has already been missed.
+func (t *Timelight) UnskipAlarm(name string) error {
+	for _, c := range t.config.Alarms {
+		if !strings.EqualFold(c.Name, name) {
+			continue
+		}
+		state := t.alarms[c.Name]
+		state.skipped = time.Time{}
+		t.alarms[c.Name] = state
+		t.log.Info("no longer skipping alarm", slog.String("alarm", c.Name))
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errAlarmNotFound, name)
+}
+
+// checkAlarms starts ramping up the lights of alarms which are due, and hands
+// lights whose alarm time has passed back to the schedule.
+func (t *Timelight) checkAlarms(now time.Time) {
+	for id, wake := range t.wakeLights {
+		if !now.Before(wake.until) {
+			delete(t.wakeLights, id)
+		}
+	}
+
+	for _, c := range t.config.Alarms {
+		wake := c.next(now, t.config.Holidays)
+		if wake.IsZero() || now.Before(wake.Add(-c.duration())) {
+			continue
+		}
+		state := t.alarms[c.Name]
+		if wake.Equal(state.rang) || wake.Equal(state.skipped) {
+			continue
+		}
+		state.rang = wake
+		t.alarms[c.Name] = state
+
+		if t.isPaused(now) {
+			t.log.Info("paused, not ringing alarm", slog.String("alarm", c.Name))
+			continue
+		}
+		t.ringAlarm(c, now, wake)
+	}
+}
+
+// ringAlarm turns on the lights in the alarm's rooms at their dimmest and
+// warmest, then ramps them up to the schedule's target at the wake time in a
+// single long transition. Timelight controls the lights from then on, even if
+// it didn't before. Lights which are already on are left alone.
+func (t *Timelight) ringAlarm(c AlarmConfig, now, wake time.Time) {
+	target := t.spec.TargetLightState(wake)
+	duration := wake.Sub(now)
+
+	var ramping int
+	for _, id := range t.alarmLights(c) {
+		light, ok := t.lights[id]
+		if !ok || light.On {
+			continue
+		}
+		// A light switched on with a transition fades from the state it was
+		// last in, so it has to be at the start state before ramping up; the
+		// turn-on is sent, and waited for, before the ramp.
+		wasActive := light.Active
+		if err := light.TurnOn(now, alarmStart(light), 0); err != nil {
+			t.logUpdateError("error while turning on light for alarm", string(id), err)
+			continue
+		}
+		light.SetActive()
+		if err := light.Update(now, target, duration); err != nil {
+			t.logUpdateError("error while ramping up light for alarm", string(id), err)
+			continue
+		}
+		t.wakeLights[id] = litLight{until: wake, wasActive: wasActive}
+		ramping++
+	}
+
+	t.log.Info("alarm ringing",
+		slog.String("alarm", c.Name),
+		slog.Int("lights", ramping),
+		slog.Time("wake", wake),
+		slog.Any("target", target),
+	)
+}
+
+// stopWaking turns off the lights that are ramping up for an alarm, and
+// restores whether timelight controls them.
+func (t *Timelight) stopWaking(now time.Time, c AlarmConfig) {
+	for _, id := range t.alarmLights(c) {
+		wake, ok := t.wakeLights[id]
+		if !ok {
+			continue
+		}
+		delete(t.wakeLights, id)
+		light, ok := t.lights[id]
+		if !ok {
+			continue
+		}
+		if err := light.TurnOff(now, 2*time.Second); err != nil {
+			t.logUpdateError("error while turning off light", string(id), err)
+			continue
+		}
+		light.Active = wake.wasActive
+	}
+}
+
+func (t *Timelight) alarmLights(c AlarmConfig) []LightID {
+	var ids []LightID
+	for _, name := range c.Rooms {
+		room, ok := t.roomByName(name)
+		if !ok {
+			t.log.Warn("room for alarm not found", slog.String("alarm", c.Name), slog.String("room", name))
+			continue
+		}
+		ids = append(ids, room.Lights...)
+	}
+	return ids
+}
+
+// alarmStart is the state lights start ramping up from.
+func alarmStart(light *Light) TargetState {
+	return DefaultTargetState.WithBrightness(alarmStartBrightness).WithColorTemp(light.warmestMirek())
+}
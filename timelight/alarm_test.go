@@ -0,0 +1,286 @@
+package timelight
+
+import (
+	"testing"
+	"time"
+)
+
+// 2024-01-01 is a Monday.
+func day(d int, hour, min int) time.Time {
+	return time.Date(2024, 1, d, hour, min, 0, 0, time.UTC)
+}
+
+func TestAlarmNext(t *testing.T) {
+	weekdays := []string{"mon", "tue", "wed", "thu", "fri"}
+	tests := []struct {
+		name     string
+		config   AlarmConfig
+		now      time.Time
+		holidays []string
+		want     time.Time
+	}{
+		{
+			name:   "later today",
+			config: AlarmConfig{Time: "07:00", Days: weekdays},
+			now:    day(1, 6, 0),
+			want:   day(1, 7, 0),
+		},
+		{
+			name:   "at the alarm time",
+			config: AlarmConfig{Time: "07:00", Days: weekdays},
+			now:    day(1, 7, 0),
+			want:   day(2, 7, 0),
+		},
+		{
+			name:   "over the weekend",
+			config: AlarmConfig{Time: "07:00", Days: weekdays},
+			now:    day(5, 8, 0),
+			want:   day(8, 7, 0),
+		},
+		{
+			name:   "empty days means every day",
+			config: AlarmConfig{Time: "07:00"},
+			now:    day(6, 8, 0),
+			want:   day(7, 7, 0),
+		},
+		{
+			name:   "days are case-insensitive",
+			config: AlarmConfig{Time: "09:30", Days: []string{"Sat"}},
+			now:    day(1, 12, 0),
+			want:   day(6, 9, 30),
+		},
+		{
+			name:     "consecutive holidays",
+			config:   AlarmConfig{Time: "07:00", Days: weekdays},
+			now:      day(1, 8, 0),
+			holidays: []string{"2024-01-02", "2024-01-03", "2024-01-04"},
+			want:     day(5, 7, 0),
+		},
+		{
+			name:     "holidays for more than a week",
+			config:   AlarmConfig{Time: "07:00", Days: []string{"mon"}},
+			now:      day(1, 8, 0),
+			holidays: []string{"2024-01-08", "2024-01-15", "2024-01-22"},
+			want:     day(29, 7, 0),
+		},
+		{
+			name:     "rings on holidays",
+			config:   AlarmConfig{Time: "07:00", Days: weekdays, OnHolidays: true},
+			now:      day(1, 8, 0),
+			holidays: []string{"2024-01-02"},
+			want:     day(2, 7, 0),
+		},
+		{
+			name:   "invalid time",
+			config: AlarmConfig{Time: "7am"},
+			now:    day(1, 6, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.next(tt.now, tt.holidays); !got.Equal(tt.want) {
+				t.Errorf("next(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func newAlarmTimelight(alarms ...AlarmConfig) *Timelight {
+	tl := newTestTimelight(Config{Alarms: alarms}, "bed", "desk", "hall")
+	tl.rooms = map[string]roomInfo{
+		"r1": {ID: "r1", Name: "Bedroom", Lights: []LightID{"bed", "desk"}},
+		"r2": {ID: "r2", Name: "Hall", Lights: []LightID{"hall"}},
+	}
+	return tl
+}
+
+var wakeUp = AlarmConfig{Name: "wake", Rooms: []string{"bedroom"}, Time: "07:00", Duration: "30m"}
+
+func TestCheckAlarms(t *testing.T) {
+	tests := []struct {
+		name    string
+		alarms  []AlarmConfig
+		setup   func(t *testing.T, tl *Timelight)
+		checks  []time.Time // Times checkAlarms runs at.
+		ramping []LightID   // Lights ramping up after the last check.
+		on      []LightID   // Lights on after the last check.
+	}{
+		{
+			name:   "not due yet",
+			alarms: []AlarmConfig{wakeUp},
+			checks: []time.Time{day(1, 6, 29)},
+		},
+		{
+			name:    "starts the ramp",
+			alarms:  []AlarmConfig{wakeUp},
+			checks:  []time.Time{day(1, 6, 30)},
+			ramping: []LightID{"bed", "desk"},
+			on:      []LightID{"bed", "desk"},
+		},
+		{
+			name:    "starts mid-ramp",
+			alarms:  []AlarmConfig{wakeUp},
+			checks:  []time.Time{day(1, 6, 50)},
+			ramping: []LightID{"bed", "desk"},
+			on:      []LightID{"bed", "desk"},
+		},
+		{
+			name:   "lights already on are left alone",
+			alarms: []AlarmConfig{wakeUp},
+			setup: func(t *testing.T, tl *Timelight) {
+				tl.lights["desk"].On = true
+			},
+			checks:  []time.Time{day(1, 6, 30)},
+			ramping: []LightID{"bed"},
+			on:      []LightID{"bed", "desk"},
+		},
+		{
+			name:    "rings once per wake time",
+			alarms:  []AlarmConfig{wakeUp},
+			checks:  []time.Time{day(1, 6, 30), day(1, 6, 40), day(1, 6, 50)},
+			ramping: []LightID{"bed", "desk"},
+			on:      []LightID{"bed", "desk"},
+		},
+		{
+			name: "due while another ramp is in progress",
+			alarms: []AlarmConfig{
+				wakeUp,
+				{Name: "early", Rooms: []string{"Bedroom", "Hall"}, Time: "07:10", Duration: "30m"},
+			},
+			checks:  []time.Time{day(1, 6, 30), day(1, 6, 40)},
+			ramping: []LightID{"bed", "desk", "hall"},
+			on:      []LightID{"bed", "desk", "hall"},
+		},
+		{
+			name:   "hands lights back to the schedule at the wake time",
+			alarms: []AlarmConfig{wakeUp},
+			checks: []time.Time{day(1, 6, 30), day(1, 7, 0)},
+			on:     []LightID{"bed", "desk"},
+		},
+		{
+			name:   "paused",
+			alarms: []AlarmConfig{wakeUp},
+			setup: func(t *testing.T, tl *Timelight) {
+				tl.Pause(day(1, 6, 45))
+			},
+			// The ring is missed, not postponed.
+			checks: []time.Time{day(1, 6, 30), day(1, 6, 50)},
+		},
+		{
+			name:   "skipped",
+			alarms: []AlarmConfig{wakeUp},
+			setup: func(t *testing.T, tl *Timelight) {
+				if err := tl.SkipAlarm(day(1, 6, 0), "WAKE"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			checks: []time.Time{day(1, 6, 30), day(1, 6, 50)},
+		},
+		{
+			name:   "skip only skips the next ring",
+			alarms: []AlarmConfig{wakeUp},
+			setup: func(t *testing.T, tl *Timelight) {
+				if err := tl.SkipAlarm(day(1, 6, 0), ""); err != nil {
+					t.Fatal(err)
+				}
+			},
+			checks:  []time.Time{day(1, 6, 30), day(2, 6, 30)},
+			ramping: []LightID{"bed", "desk"},
+			on:      []LightID{"bed", "desk"},
+		},
+		{
+			name:   "unskipped",
+			alarms: []AlarmConfig{wakeUp},
+			setup: func(t *testing.T, tl *Timelight) {
+				if err := tl.SkipAlarm(day(1, 6, 0), "wake"); err != nil {
+					t.Fatal(err)
+				}
+				if err := tl.UnskipAlarm("wake"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			checks:  []time.Time{day(1, 6, 30)},
+			ramping: []LightID{"bed", "desk"},
+			on:      []LightID{"bed", "desk"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tl := newAlarmTimelight(tt.alarms...)
+			if tt.setup != nil {
+				tt.setup(t, tl)
+			}
+			for _, now := range tt.checks {
+				tl.checkAlarms(now)
+			}
+
+			for id, light := range tl.lights {
+				_, ramping := tl.wakeLights[id]
+				if want := containsLight(tt.ramping, id); ramping != want {
+					t.Errorf("light %s ramping = %v, want %v", id, ramping, want)
+				}
+				if want := containsLight(tt.on, id); light.On != want {
+					t.Errorf("light %s on = %v, want %v", id, light.On, want)
+				}
+			}
+		})
+	}
+}
+
+func containsLight(ids []LightID, id LightID) bool {
+	for _, l := range ids {
+		if l == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSkipAlarmWhileRamping(t *testing.T) {
+	tl := newAlarmTimelight(wakeUp)
+	tl.lights["desk"].SetInactive()
+
+	tl.checkAlarms(day(1, 6, 40))
+	for _, id := range []LightID{"bed", "desk"} {
+		if l := tl.lights[id]; !l.On || !l.Active {
+			t.Fatalf("light %s: on %v, active %v; want ramping under timelight's control", id, l.On, l.Active)
+		}
+	}
+	if alarms := tl.Alarms(day(1, 6, 40)); !alarms[0].Ringing {
+		t.Errorf("alarm not reported as ringing: %+v", alarms[0])
+	}
+
+	if err := tl.SkipAlarm(day(1, 6, 45), "wake"); err != nil {
+		t.Fatal(err)
+	}
+	// The lights are turned off, and timelight controls them as before once the
+	// bridge reports them off.
+	tl.handleLightUpdate(powerUpdate("bed", false), day(1, 6, 45))
+	tl.handleLightUpdate(powerUpdate("desk", false), day(1, 6, 45))
+	bed, desk := tl.lights["bed"], tl.lights["desk"]
+	if bed.On || !bed.Active {
+		t.Errorf("bed: on %v, active %v; want off and active", bed.On, bed.Active)
+	}
+	if desk.On || desk.Active {
+		t.Errorf("desk: on %v, active %v; want off and inactive", desk.On, desk.Active)
+	}
+	if len(tl.wakeLights) != 0 {
+		t.Errorf("lights still ramping: %v", tl.wakeLights)
+	}
+	if tl.metrics.overrides != 0 {
+		t.Errorf("%v overrides counted, want none", tl.metrics.overrides)
+	}
+	alarms := tl.Alarms(day(1, 6, 45))
+	if !alarms[0].Skipped || alarms[0].Ringing {
+		t.Errorf("alarm = %+v, want skipped and not ringing", alarms[0])
+	}
+
+	// Unskipping doesn't ring the alarm again, since it already rang.
+	if err := tl.UnskipAlarm("wake"); err != nil {
+		t.Fatal(err)
+	}
+	tl.checkAlarms(day(1, 6, 50))
+	if bed.On {
+		t.Error("alarm rang again after being unskipped")
+	}
+}
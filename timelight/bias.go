@@ -0,0 +1,309 @@
+package timelight
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aldld/hue/hue"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultBiasDecay = 2 * time.Hour
+	biasTransition   = 1 * time.Second
+
+	// Bias changes are applied this long after the first one, so that the
+	// reports of a turning dial update each light once.
+	biasFlushDelay = 250 * time.Millisecond
+
+	maxBrightnessBias = 400 // Percent of the scheduled brightness.
+	maxMirekBias      = MaxMirek - MinMirek
+)
+
+// BiasConfig controls biases: offsets from the schedule's target, set for a
+// room or a light with buttons or the API.
+type BiasConfig struct {
+	// Decay is how long a bias takes to fade back to zero after it was last
+	// changed, e.g. "2h".
+	Decay string `toml:"decay"`
+
+	// Timeout is the old name of Decay, from when biases were dropped all at
+	// once. Deprecated: use Decay.
+	Timeout string `toml:"timeout"`
+
+	// FromManualChanges turns manual brightness and color temperature changes
+	// to active lights into a bias of the light, so that they keep following
+	// the schedule instead of being deactivated.
+	FromManualChanges bool `toml:"from_manual_changes"`
+}
+
+func (c BiasConfig) decay() time.Duration {
+	if c.Decay == "" {
+		return parsePositiveDuration(c.Timeout, defaultBiasDecay)
+	}
+	return parsePositiveDuration(c.Decay, defaultBiasDecay)
+}
+
+// Bias offsets the schedule's target.
+type Bias struct {
+	Brightness float64 `json:"brightness"` // Percent of the scheduled brightness, e.g. -20.
+	Mirek      float64 `json:"mirek"`      // Added to the scheduled color temperature.
+}
+
+func (b Bias) add(other Bias) Bias {
+	return Bias{Brightness: b.Brightness + other.Brightness, Mirek: b.Mirek + other.Mirek}
+}
+
+func (b Bias) clamped() Bias {
+	return Bias{
+		Brightness: clamp(b.Brightness, -maxBrightnessBias, maxBrightnessBias),
+		Mirek:      clamp(b.Mirek, -maxMirekBias, maxMirekBias),
+	}
+}
+
+// biasScope selects the lights a bias applies to: a single light, the lights
+// in a room, or every light if both are empty.
+type biasScope struct {
+	Room  string // Lowercase.
+	Light LightID
+}
+
+// biasEntry is a bias as it was set, before it decays.
+type biasEntry struct {
+	bias Bias
+	set  time.Time
+}
+
+// at returns the bias after decaying linearly until now.
+func (e biasEntry) at(now time.Time, decay time.Duration) Bias {
+	elapsed := now.Sub(e.set)
+	if elapsed >= decay {
+		return Bias{}
+	}
+	f := 1.0
+	if elapsed > 0 {
+		f -= float64(elapsed) / float64(decay)
+	}
+	return Bias{Brightness: e.bias.Brightness * f, Mirek: e.bias.Mirek * f}
+}
+
+// BiasInfo describes a bias in the API.
+type BiasInfo struct {
+	Room    string    `json:"room,omitempty"`
+	Light   LightID   `json:"light,omitempty"`
+	Bias    Bias      `json:"bias"`    // The bias now.
+	Initial Bias      `json:"initial"` // The bias when it was set.
+	Set     time.Time `json:"set"`
+	Until   time.Time `json:"until"` // When the bias has decayed to zero.
+}
+
+// Biases returns the biases that have not decayed yet.
+func (t *Timelight) Biases(now time.Time) []BiasInfo {
+	decay := t.config.Bias.decay()
+	biases := make([]BiasInfo, 0, len(t.biases))
+	for scope, entry := range t.biases {
+		if !now.Before(entry.set.Add(decay)) {
+			continue
+		}
+		biases = append(biases, BiasInfo{
+			Room:    scope.Room,
+			Light:   scope.Light,
+			Bias:    entry.at(now, decay),
+			Initial: entry.bias,
+			Set:     entry.set,
+			Until:   entry.set.Add(decay),
+		})
+	}
+	sort.Slice(biases, func(i, j int) bool {
+		if biases[i].Room != biases[j].Room {
+			return biases[i].Room < biases[j].Room
+		}
+		return biases[i].Light < biases[j].Light
+	})
+	return biases
+}
+
+// SetBias replaces the bias of a room, a light, or every light if both are
+// empty, and soon applies it to the active lights. A zero bias removes it.
+func (t *Timelight) SetBias(now time.Time, room string, light LightID, bias Bias) error {
+	scope, err := t.biasScope(room, light)
+	if err != nil {
+		return err
+	}
+	t.setBias(now, scope, bias)
+	t.applyBias(scope)
+	return nil
+}
+
+// adjustBias adds delta to the current bias of a scope.
+func (t *Timelight) adjustBias(now time.Time, scope biasScope, delta Bias) error {
+	scope, err := t.biasScope(scope.Room, scope.Light)
+	if err != nil {
+		return err
+	}
+	current := t.biases[scope].at(now, t.config.Bias.decay())
+	t.setBias(now, scope, current.add(delta))
+	t.applyBias(scope)
+	return nil
+}
+
+func (t *Timelight) biasScope(room string, light LightID) (biasScope, error) {
+	switch {
+	case room != "" && light != "":
+		return biasScope{}, badRequest(fmt.Errorf("set either a room or a light, not both"))
+	case room != "":
+		if _, ok := t.roomByName(room); !ok {
+			return biasScope{}, fmt.Errorf("%w: %s", errRoomNotFound, room)
+		}
+	case light != "":
+		if _, ok := t.lights[light]; !ok {
+			return biasScope{}, fmt.Errorf("%w: %s", errLightNotFound, light)
+		}
+	}
+	return biasScope{Room: strings.ToLower(room), Light: light}, nil
+}
+
+func (t *Timelight) setBias(now time.Time, scope biasScope, bias Bias) {
+	bias = bias.clamped()
+	if bias == (Bias{}) {
+		delete(t.biases, scope)
+	} else {
+		t.biases[scope] = biasEntry{bias: bias, set: now}
+	}
+	t.log.Info("bias changed",
+		slog.String("room", scope.Room),
+		slog.String("light", string(scope.Light)),
+		slog.Float64("brightness", bias.Brightness),
+		slog.Float64("mirek", bias.Mirek),
+	)
+}
+
+// applyBias marks the active lights in the scope to be updated by flushBiases.
+func (t *Timelight) applyBias(scope biasScope) {
+	if t.dirtyBiases == nil {
+		t.dirtyBiases = make(map[biasScope]bool)
+	}
+	t.dirtyBiases[scope] = true
+}
+
+// flushBiases updates the lights in the scopes whose biases changed since the
+// last flush.
+func (t *Timelight) flushBiases(now time.Time) {
+	scopes := t.dirtyBiases
+	t.dirtyBiases = nil
+	if len(scopes) == 0 {
+		return
+	}
+	t.sendLightUpdates(now, t.spec.TargetLightState(now), biasTransition, func(light *Light) bool {
+		for scope := range scopes {
+			if t.inBiasScope(light.ID, scope) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (t *Timelight) inBiasScope(id LightID, scope biasScope) bool {
+	switch {
+	case scope.Light != "":
+		return scope.Light == id
+	case scope.Room != "":
+		return t.inRooms(id, []string{scope.Room})
+	default:
+		return true
+	}
+}
+
+// lightBias returns the sum of the biases which apply to a light, except for
+// the one in the given scope.
+func (t *Timelight) lightBias(id LightID, now time.Time, except *biasScope) Bias {
+	decay := t.config.Bias.decay()
+	var total Bias
+	for scope, entry := range t.biases {
+		if except != nil && scope == *except {
+			continue
+		}
+		if t.inBiasScope(id, scope) {
+			total = total.add(entry.at(now, decay))
+		}
+	}
+	return total
+}
+
+// biased applies the light's biases to the target.
+func (t *Timelight) biased(light *Light, now time.Time, target TargetState) TargetState {
+	if len(t.biases) == 0 {
+		return target
+	}
+	bias := t.lightBias(light.ID, now, nil)
+	if target.HasBrightness && bias.Brightness != 0 {
+		brightness := target.Brightness * (1 + bias.Brightness/100)
+		target = target.WithBrightness(clamp(brightness, MinBrightness, MaxBrightness))
+	}
+	if target.HasTempMirek && bias.Mirek != 0 {
+		mirek := clamp(float64(target.TempMirek)+bias.Mirek, MinMirek, float64(light.warmestMirek()))
+		target = target.WithColorTemp(int(math.Round(mirek)))
+	}
+	return target
+}
+
+// expireBiases forgets the biases which have decayed to zero.
+func (t *Timelight) expireBiases(now time.Time) {
+	decay := t.config.Bias.decay()
+	for scope, entry := range t.biases {
+		if !now.Before(entry.set.Add(decay)) {
+			delete(t.biases, scope)
+		}
+	}
+}
+
+// biasFromManualChange turns a manual change of an active light into a bias of
+// the light, such that the biased target matches the light's new state. It
+// reports whether it did; changes it can't express as a bias, such as turning
+// the light off, are not.
+func (t *Timelight) biasFromManualChange(light *Light, update hue.Light, now time.Time) bool {
+	if !t.config.Bias.FromManualChanges {
+		return false
+	}
+	if update.On != nil && !update.On.On {
+		return false
+	}
+	if update.ColorTemperature != nil && !update.ColorTemperature.MirekValid {
+		return false // Set to a color.
+	}
+	if _, ok := t.pathLights[light.ID]; ok {
+		return false
+	}
+
+	scope := biasScope{Light: light.ID}
+	target := t.spec.TargetLightState(now)
+	scheduled := t.motionTarget(light.ID, now, target)
+	others := t.lightBias(light.ID, now, &scope)
+	bias := t.biases[scope].at(now, t.config.Bias.decay())
+
+	if update.Dimming != nil && light.HasBrightness && scheduled.HasBrightness && scheduled.Brightness > 0 {
+		bias.Brightness = (update.Dimming.Brightness/scheduled.Brightness-1)*100 - others.Brightness
+	}
+	if update.ColorTemperature != nil && light.HasColorTemperature && scheduled.HasTempMirek {
+		bias.Mirek = float64(update.ColorTemperature.Mirek-scheduled.TempMirek) - others.Mirek
+	}
+
+	t.setBias(now, scope, bias)
+	// The light is already in the biased state, so there is nothing to send.
+	light.TargetState = light.restrictTarget(t.lightTarget(light, now, target))
+	return true
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
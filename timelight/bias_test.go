@@ -0,0 +1,196 @@
+package timelight
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/aldld/hue/hue"
+)
+
+func TestBiasEntryAt(t *testing.T) {
+	set := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	e := biasEntry{bias: Bias{Brightness: -40, Mirek: 100}, set: set}
+	decay := 2 * time.Hour
+
+	tests := []struct {
+		elapsed time.Duration
+		want    Bias
+	}{
+		{-time.Minute, Bias{-40, 100}}, // Clock went backwards.
+		{0, Bias{-40, 100}},
+		{30 * time.Minute, Bias{-30, 75}},
+		{time.Hour, Bias{-20, 50}},
+		{decay - 12*time.Minute, Bias{-4, 10}},
+		{decay, Bias{}},
+		{3 * time.Hour, Bias{}},
+	}
+	for _, tt := range tests {
+		got := e.at(set.Add(tt.elapsed), decay)
+		if !biasNear(got, tt.want) {
+			t.Errorf("at(+%v) = %+v, want %+v", tt.elapsed, got, tt.want)
+		}
+	}
+
+	if got := (biasEntry{}).at(set, decay); got != (Bias{}) {
+		t.Errorf("zero entry at(%v) = %+v, want no bias", set, got)
+	}
+}
+
+func biasNear(a, b Bias) bool {
+	return math.Abs(a.Brightness-b.Brightness) < 1e-9 && math.Abs(a.Mirek-b.Mirek) < 1e-9
+}
+
+func newBiasTimelight() *Timelight {
+	tl := newTestTimelight(Config{}, "l1", "l2", "l3")
+	tl.rooms = map[string]roomInfo{
+		"r1": {ID: "r1", Name: "Living", Lights: []LightID{"l1", "l2"}},
+	}
+	return tl
+}
+
+func TestLightBiasStacksScopes(t *testing.T) {
+	tl := newBiasTimelight()
+	set := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tl.setBias(set, biasScope{}, Bias{Brightness: 10})
+	tl.setBias(set, biasScope{Room: "living"}, Bias{Brightness: -20, Mirek: 40})
+	tl.setBias(set, biasScope{Light: "l1"}, Bias{Brightness: 5, Mirek: -10})
+
+	tests := []struct {
+		id     LightID
+		at     time.Duration
+		except *biasScope
+		want   Bias
+	}{
+		{id: "l1", want: Bias{-5, 30}},
+		{id: "l2", want: Bias{-10, 40}},
+		{id: "l3", want: Bias{10, 0}},
+		{id: "l1", at: time.Hour, want: Bias{-2.5, 15}},
+		{id: "l1", at: 2 * time.Hour, want: Bias{}},
+		{id: "l1", except: &biasScope{Light: "l1"}, want: Bias{-10, 40}},
+		{id: "l1", except: &biasScope{Room: "living"}, want: Bias{15, -10}},
+		{id: "l3", except: &biasScope{Light: "l1"}, want: Bias{10, 0}},
+	}
+	for _, tt := range tests {
+		got := tl.lightBias(tt.id, set.Add(tt.at), tt.except)
+		if !biasNear(got, tt.want) {
+			t.Errorf("lightBias(%s, +%v, %v) = %+v, want %+v", tt.id, tt.at, tt.except, got, tt.want)
+		}
+	}
+}
+
+func TestBiased(t *testing.T) {
+	tl := newBiasTimelight()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	light := tl.lights["l1"]
+	light.MaxMirek = 350
+	tl.setBias(now, biasScope{}, Bias{Brightness: 50})
+	tl.setBias(now, biasScope{Light: "l1"}, Bias{Brightness: -10, Mirek: 100})
+
+	// 50% scheduled, +40% of that, and the mirek capped at the light's warmest.
+	got := tl.biased(light, now, testTarget)
+	want := testTarget.WithBrightness(70).WithColorTemp(350)
+	if got != want {
+		t.Errorf("biased = %+v, want %+v", got, want)
+	}
+}
+
+func TestBiasFromManualChange(t *testing.T) {
+	tests := []struct {
+		name   string
+		others Bias // Bias of the light's room.
+		update hue.Light
+		want   Bias // Bias of the light.
+		ok     bool
+	}{
+		{
+			name:   "dimmed",
+			update: hue.Light{Dimming: &hue.Dimming{Brightness: 25}},
+			want:   Bias{Brightness: -50},
+			ok:     true,
+		},
+		{
+			name:   "brightened with room bias",
+			others: Bias{Brightness: 20, Mirek: -30},
+			update: hue.Light{Dimming: &hue.Dimming{Brightness: 75}},
+			want:   Bias{Brightness: 30},
+			ok:     true,
+		},
+		{
+			name:   "warmer with room bias",
+			others: Bias{Mirek: -30},
+			update: hue.Light{ColorTemperature: &hue.ColorTemperature{Mirek: 350, MirekValid: true}},
+			want:   Bias{Mirek: 80},
+			ok:     true,
+		},
+		{
+			name:   "set to a color",
+			update: hue.Light{ColorTemperature: &hue.ColorTemperature{MirekValid: false}},
+		},
+		{
+			name:   "turned off",
+			update: hue.Light{On: &hue.LightOn{On: false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tl := newBiasTimelight()
+			tl.config.Bias.FromManualChanges = true
+			now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			if tt.others != (Bias{}) {
+				tl.setBias(now, biasScope{Room: "living"}, tt.others)
+			}
+			light := tl.lights["l1"]
+			tt.update.ID = "l1"
+
+			if ok := tl.biasFromManualChange(light, tt.update, now); ok != tt.ok {
+				t.Fatalf("biasFromManualChange = %v, want %v", ok, tt.ok)
+			}
+			if got := tl.biases[biasScope{Light: "l1"}].bias; !biasNear(got, tt.want) {
+				t.Errorf("light bias = %+v, want %+v", got, tt.want)
+			}
+			if !tt.ok {
+				return
+			}
+			// The biased target matches the light's new state.
+			target := tl.lightTarget(light, now, testTarget)
+			if d := tt.update.Dimming; d != nil && math.Abs(target.Brightness-d.Brightness) > 1e-9 {
+				t.Errorf("biased brightness = %v, want %v", target.Brightness, d.Brightness)
+			}
+			if c := tt.update.ColorTemperature; c != nil && target.TempMirek != c.Mirek {
+				t.Errorf("biased mirek = %v, want %v", target.TempMirek, c.Mirek)
+			}
+			if light.TargetState != target {
+				t.Errorf("light target = %+v, want %+v", light.TargetState, target)
+			}
+		})
+	}
+}
+
+func TestFlushBiasesCoalesces(t *testing.T) {
+	tl := newBiasTimelight()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		if err := tl.adjustBias(now, biasScope{Room: "Living"}, Bias{Brightness: -10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tl.dirtyBiases) != 1 {
+		t.Fatalf("dirty scopes = %v, want only the room", tl.dirtyBiases)
+	}
+	for _, l := range tl.lights {
+		if l.TargetState != (TargetState{}) {
+			t.Fatalf("light %s was updated before the flush", l.ID)
+		}
+	}
+
+	tl.flushBiases(now)
+	if len(tl.dirtyBiases) != 0 {
+		t.Errorf("dirty scopes = %v after flush, want none", tl.dirtyBiases)
+	}
+	for id, want := range map[LightID]float64{"l1": 25, "l2": 25, "l3": 0} {
+		if got := tl.lights[id].TargetState.Brightness; math.Abs(got-want) > 1e-9 {
+			t.Errorf("light %s brightness = %v, want %v", id, got, want)
+		}
+	}
+}
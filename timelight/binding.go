@@ -0,0 +1,281 @@
+package timelight
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldld/hue/hue"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	eventRotate = "rotate"
+)
+
+// Binding actions. The others are passed to runCommand.
+const (
+	actionBrightnessUp   = "brightness_up"
+	actionBrightnessDown = "brightness_down"
+	actionWarmer         = "warmer"
+	actionCooler         = "cooler"
+)
+
+// Default steps of the bias actions, per button press and per rotary step.
+var biasSteps = map[string]struct{ press, rotary float64 }{
+	actionBrightnessUp:   {10, 0.2}, // Percent of the scheduled brightness.
+	actionBrightnessDown: {10, 0.2},
+	actionWarmer:         {20, 0.5}, // Mirek.
+	actionCooler:         {20, 0.5},
+}
+
+var bindingActions = []string{
+	"activate_room", "deactivate_room", "pause", "resume", "update", "profile", "skip_alarm",
+	actionBrightnessUp, actionBrightnessDown, actionWarmer, actionCooler,
+}
+
+var bindingEvents = []string{
+	hue.ButtonInitialPress, hue.ButtonRepeat, hue.ButtonShortRelease, hue.ButtonLongPress,
+	hue.ButtonLongRelease, eventRotate,
+}
+
+// BindingConfig runs a timelight action when a button is pressed or a dial is
+// turned.
+type BindingConfig struct {
+	// Device is the name of the switch, or the ID of its button or rotary.
+	Device string `toml:"device"`
+
+	// Button is the number of the button on the switch, e.g. 1 for "on" and 4
+	// for "off" on a Hue dimmer switch. Any button matches if it is 0.
+	Button int `toml:"button"`
+
+	// Event is a button event, e.g. "short_release" or "long_press", or
+	// "rotate" for dials.
+	Event string `toml:"event"`
+
+	// Action is one of:
+	//
+	//	activate_room     Hand Room back to timelight, at the current target.
+	//	deactivate_room   Stop controlling Room.
+	//	pause             Pause for Arg, e.g. "1h"; until resumed if empty.
+	//	resume
+	//	update            Apply the current target now.
+	//	profile           Switch to the profile named Arg.
+	//	skip_alarm        Skip the next ring of the alarm named Arg, or of every alarm.
+	//	brightness_up     Bias the brightness of Light, Room or every light by Arg
+	//	brightness_down   percent of the schedule's brightness; 10 if empty.
+	//	warmer            Bias the color temperature of Light, Room or every
+	//	cooler            light by Arg mirek; 20 if empty.
+	//
+	// For dials, the bias actions' Arg is per rotary step, 0.2 percent or 0.5
+	// mirek if empty, and turning counter-clockwise reverses the direction.
+	Action string  `toml:"action"`
+	Room   string  `toml:"room"`
+	Light  LightID `toml:"light"`
+	Arg    string  `toml:"arg"`
+}
+
+func (c BindingConfig) validate(ps *Problems, key string) {
+	if c.Device == "" {
+		ps.errorf(key+".device", "device is required")
+	}
+	if c.Button < 0 {
+		ps.errorf(key+".button", "must not be negative")
+	}
+	if !contains(bindingEvents, c.Event) {
+		ps.errorf(key+".event", "unknown event %q; use one of %s", c.Event, strings.Join(bindingEvents, ", "))
+	}
+	if !contains(bindingActions, c.Action) {
+		ps.errorf(key+".action", "unknown action %q; use one of %s", c.Action, strings.Join(bindingActions, ", "))
+	}
+
+	switch c.Action {
+	case "activate_room", "deactivate_room":
+		if c.Room == "" {
+			ps.errorf(key+".room", "room is required for %s", c.Action)
+		}
+	case "pause":
+		if c.Arg != "" {
+			if d, err := time.ParseDuration(c.Arg); err != nil || d <= 0 {
+				ps.errorf(key+".arg", "invalid duration %q", c.Arg)
+			}
+		}
+	case "profile":
+		if c.Arg == "" {
+			ps.errorf(key+".arg", "profile name is required")
+		}
+	case actionBrightnessUp, actionBrightnessDown, actionWarmer, actionCooler:
+		if c.Room != "" && c.Light != "" {
+			ps.errorf(key+".light", "set either room or light, not both")
+		}
+		if c.Arg != "" {
+			if v, err := strconv.ParseFloat(c.Arg, 64); err != nil || v <= 0 {
+				ps.errorf(key+".arg", "must be a positive number")
+			}
+		}
+	}
+	if _, isBias := biasSteps[c.Action]; c.Event == eventRotate && !isBias {
+		ps.warnf(key+".action", "%s runs on every step of the dial", c.Action)
+	}
+}
+
+// switchInfo identifies a button or rotary resource.
+type switchInfo struct {
+	Device    string // Name of the owning device.
+	ControlID int    // Button number; 0 for rotaries.
+}
+
+// loadSwitches loads the buttons and rotaries on the bridge, if any bindings
+// are configured.
+func (t *Timelight) loadSwitches() error {
+	t.switches = nil
+	if len(t.config.Bindings) == 0 {
+		return nil
+	}
+
+	buttons, err := hue.List[hue.Button](t.hue)
+	if err != nil {
+		return err
+	}
+	rotaries, err := hue.List[hue.RelativeRotary](t.hue)
+	if err != nil {
+		return err
+	}
+	devices, err := t.devicesByID()
+	if err != nil {
+		return err
+	}
+	deviceName := func(owner *hue.ResourceRef) string {
+		if owner == nil {
+			return ""
+		}
+		if d, ok := devices[owner.ID]; ok && d.Metadata != nil {
+			return d.Metadata.Name
+		}
+		return ""
+	}
+
+	t.switches = make(map[string]switchInfo, len(buttons)+len(rotaries))
+	for _, b := range buttons {
+		info := switchInfo{Device: deviceName(b.Owner)}
+		if b.Metadata != nil {
+			info.ControlID = b.Metadata.ControlID
+		}
+		t.switches[b.ID] = info
+	}
+	for _, r := range rotaries {
+		t.switches[r.ID] = switchInfo{Device: deviceName(r.Owner)}
+	}
+
+	for _, b := range t.config.Bindings {
+		if !t.switchExists(b.Device) {
+			t.log.Warn("switch for binding not found", slog.String("device", b.Device))
+		}
+	}
+	return nil
+}
+
+func (t *Timelight) switchExists(device string) bool {
+	for id, info := range t.switches {
+		if id == device || strings.EqualFold(info.Device, device) {
+			return true
+		}
+	}
+	return false
+}
+
+// bindings returns the bindings which match an event of a switch.
+func (t *Timelight) bindings(id, event string) []BindingConfig {
+	info, ok := t.switches[id]
+	if !ok {
+		return nil
+	}
+	var matches []BindingConfig
+	for _, b := range t.config.Bindings {
+		if b.Device != id && !strings.EqualFold(b.Device, info.Device) {
+			continue
+		}
+		if b.Event != event || (b.Button != 0 && b.Button != info.ControlID) {
+			continue
+		}
+		matches = append(matches, b)
+	}
+	return matches
+}
+
+func (t *Timelight) handleButton(button hue.Button, now time.Time) {
+	if button.Button == nil {
+		return
+	}
+	event := button.Button.LastEvent
+	if report := button.Button.ButtonReport; report != nil {
+		event = report.Event
+	}
+	for _, b := range t.bindings(button.ID, event) {
+		t.runBinding(b, now, 1)
+	}
+}
+
+func (t *Timelight) handleRotary(rotary hue.RelativeRotary, now time.Time) {
+	if rotary.RelativeRotary == nil {
+		return
+	}
+	var rotation *hue.Rotation
+	if report := rotary.RelativeRotary.RotaryReport; report != nil {
+		rotation = report.Rotation
+	} else if event := rotary.RelativeRotary.LastEvent; event != nil {
+		rotation = event.Rotation
+	}
+	if rotation == nil {
+		return
+	}
+	steps := float64(rotation.Steps)
+	if rotation.Direction == "counter_clock_wise" {
+		steps = -steps
+	}
+	for _, b := range t.bindings(rotary.ID, eventRotate) {
+		t.runBinding(b, now, steps)
+	}
+}
+
+// runBinding runs the binding's action. Bias changes are scaled by steps, which
+// is negative for dials turned counter-clockwise.
+func (t *Timelight) runBinding(b BindingConfig, now time.Time, steps float64) {
+	t.log.Info("running binding",
+		slog.String("device", b.Device),
+		slog.String("event", b.Event),
+		slog.String("action", b.Action),
+	)
+
+	var err error
+	switch b.Action {
+	case actionBrightnessUp, actionBrightnessDown, actionWarmer, actionCooler:
+		defaults := biasSteps[b.Action]
+		step := defaults.press
+		if b.Event == eventRotate {
+			step = defaults.rotary
+		}
+		if v, perr := strconv.ParseFloat(b.Arg, 64); perr == nil && v > 0 {
+			step = v
+		}
+		var delta Bias
+		switch b.Action {
+		case actionBrightnessUp:
+			delta.Brightness = step * steps
+		case actionBrightnessDown:
+			delta.Brightness = -step * steps
+		case actionWarmer:
+			delta.Mirek = step * steps
+		case actionCooler:
+			delta.Mirek = -step * steps
+		}
+		err = t.adjustBias(now, biasScope{Room: b.Room, Light: b.Light}, delta)
+	case "activate_room", "deactivate_room":
+		err = t.runCommand(b.Action, b.Room)
+	default:
+		err = t.runCommand(b.Action, b.Arg)
+	}
+	if err != nil {
+		t.log.Error("binding failed", slog.String("action", b.Action), slog.Any("err", err))
+	}
+}
@@ -0,0 +1,293 @@
+package timelight
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// MQTT 3.1.1 control packet types.
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// testBroker is an in-process MQTT 3.1.1 broker, just enough of one to test
+// timelight's client against: it keeps retained messages, delivers messages to
+// subscribers at QoS 0, and publishes the will of clients whose connection is
+// lost.
+type testBroker struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	conns    map[*brokerConn]bool
+	retained map[string]string
+	history  map[string][]string // Every retained payload of each topic.
+	connects int
+}
+
+type brokerConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	subs    []string
+	will    *mqttMessage
+}
+
+func newTestBroker(tb testing.TB) *testBroker {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	b := &testBroker{
+		ln:       ln,
+		conns:    make(map[*brokerConn]bool),
+		retained: make(map[string]string),
+		history:  make(map[string][]string),
+	}
+	go b.serve()
+	tb.Cleanup(b.close)
+	return b
+}
+
+func (b *testBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &brokerConn{conn: conn}
+		b.mu.Lock()
+		b.conns[c] = true
+		b.mu.Unlock()
+		go b.handle(c)
+	}
+}
+
+// drop closes every connection without a DISCONNECT, as if the network failed.
+func (b *testBroker) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.conns {
+		c.conn.Close()
+	}
+}
+
+func (b *testBroker) close() {
+	b.ln.Close()
+	b.drop()
+}
+
+// get returns the retained payload of a topic, the payloads retained so far,
+// and the number of connections accepted so far.
+func (b *testBroker) get(topic string) (payload string, history []string, connects int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payload = b.retained[topic]
+	return payload, append([]string(nil), b.history[topic]...), b.connects
+}
+
+func (b *testBroker) handle(c *brokerConn) {
+	defer func() {
+		c.conn.Close()
+		b.mu.Lock()
+		delete(b.conns, c)
+		will := c.will
+		b.mu.Unlock()
+		if will != nil {
+			b.publish(*will)
+		}
+	}()
+
+	r := bufio.NewReader(c.conn)
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case packetConnect:
+			will, err := parseConnect(body)
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			c.will = will
+			b.connects++
+			b.mu.Unlock()
+			c.write(packetConnack<<4, []byte{0, 0})
+
+		case packetPublish:
+			m, id := parsePublish(header, body)
+			if header&0x06 != 0 {
+				c.write(packetPuback<<4, id)
+			}
+			b.publish(m)
+
+		case packetSubscribe:
+			id, filters := body[:2], body[2:]
+			granted := []byte{}
+			var subs []string
+			for len(filters) > 0 {
+				var filter string
+				filter, filters = readString(filters)
+				filters = filters[1:] // Requested QoS.
+				subs = append(subs, filter)
+				granted = append(granted, 0)
+			}
+			b.mu.Lock()
+			c.subs = append(c.subs, subs...)
+			var retained []mqttMessage
+			for topic, payload := range b.retained {
+				for _, filter := range subs {
+					if topicMatches(filter, topic) {
+						retained = append(retained, mqttMessage{topic, true, payload})
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+			c.write(packetSuback<<4, append(id, granted...))
+			for _, m := range retained {
+				c.send(m)
+			}
+
+		case packetPingreq:
+			c.write(packetPingresp<<4, nil)
+
+		case packetDisconnect:
+			b.mu.Lock()
+			c.will = nil
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+// publish retains a message if needed and delivers it to the subscribers.
+func (b *testBroker) publish(m mqttMessage) {
+	b.mu.Lock()
+	if m.retained {
+		if m.payload == "" {
+			delete(b.retained, m.topic)
+		} else {
+			b.retained[m.topic] = m.payload
+		}
+		b.history[m.topic] = append(b.history[m.topic], m.payload)
+	}
+	var subscribers []*brokerConn
+	for c := range b.conns {
+		for _, filter := range c.subs {
+			if topicMatches(filter, m.topic) {
+				subscribers = append(subscribers, c)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	m.retained = false
+	for _, c := range subscribers {
+		c.send(m)
+	}
+}
+
+func (c *brokerConn) send(m mqttMessage) {
+	header := byte(packetPublish << 4)
+	if m.retained {
+		header |= 1
+	}
+	c.write(header, append(appendString(nil, m.topic), m.payload...))
+}
+
+func (c *brokerConn) write(header byte, body []byte) {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if n == 0 {
+			break
+		}
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.Write(append(packet, body...))
+}
+
+func readPacket(r *bufio.Reader) (header byte, body []byte, err error) {
+	if header, err = r.ReadByte(); err != nil {
+		return 0, nil, err
+	}
+	var n, shift int
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(digit&0x7f) << shift
+		shift += 7
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	body = make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+// parseConnect returns the will of a CONNECT packet, if any.
+func parseConnect(body []byte) (*mqttMessage, error) {
+	protocol, rest := readString(body)
+	if protocol != "MQTT" || len(rest) < 4 {
+		return nil, errors.New("unsupported protocol")
+	}
+	flags := rest[1]
+	_, rest = readString(rest[4:]) // Client ID.
+	if flags&0x04 == 0 {
+		return nil, nil
+	}
+	topic, rest := readString(rest)
+	payload, _ := readString(rest)
+	return &mqttMessage{topic: topic, retained: flags&0x20 != 0, payload: payload}, nil
+}
+
+// parsePublish returns the message of a PUBLISH packet, and its packet ID if it
+// has one.
+func parsePublish(header byte, body []byte) (mqttMessage, []byte) {
+	topic, rest := readString(body)
+	var id []byte
+	if header&0x06 != 0 {
+		id, rest = rest[:2], rest[2:]
+	}
+	return mqttMessage{topic: topic, retained: header&0x01 != 0, payload: string(rest)}, id
+}
+
+func readString(b []byte) (string, []byte) {
+	n := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
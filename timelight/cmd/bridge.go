@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aldld/hue/hue"
+)
+
+const (
+	pairTimeout  = 60 * time.Second
+	pairInterval = 2 * time.Second
+)
+
+func runPair(e *env, args []string) error {
+	flags := newFlags(e, "pair")
+	addr := flags.String("addr", "", "address of the bridge (default: bridge.addr from the config file)")
+	name := flags.String("name", "", "device type to register (default: timelight#<hostname>)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *addr == "" {
+		config, err := e.loadConfig()
+		if err != nil {
+			return err
+		}
+		*addr = config.Bridge.Addr
+	}
+	if *addr == "" {
+		return usageErrorf("no bridge address; pass -addr or set bridge.addr in the config file")
+	}
+	if *name == "" {
+		hostname, _ := os.Hostname()
+		*name = "timelight#" + hostname
+	}
+
+	fmt.Fprintf(e.stdout, "Press the link button on the bridge at %s...\n", *addr)
+
+	deadline := time.Now().Add(pairTimeout)
+	for {
+		creds, err := hue.Pair(*addr, *name)
+		if err == nil {
+			fmt.Fprintln(e.stdout, "Paired. Add the following to your config file:")
+			fmt.Fprintln(e.stdout)
+			fmt.Fprintln(e.stdout, "[bridge]")
+			fmt.Fprintf(e.stdout, "addr = %q\n", *addr)
+			fmt.Fprintf(e.stdout, "username = %q\n", creds.Username)
+			return nil
+		}
+		if !errors.Is(err, hue.ErrLinkButtonNotPressed) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the link button to be pressed")
+		}
+		time.Sleep(pairInterval)
+	}
+}
+
+func runDiscover(e *env, args []string) error {
+	if err := parseFlags(newFlags(e, "discover"), args); err != nil {
+		return err
+	}
+
+	bridges, err := hue.Discover()
+	if err != nil {
+		return err
+	}
+	if len(bridges) == 0 {
+		fmt.Fprintln(e.stdout, "No bridges found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tADDRESS\tPORT")
+	for _, b := range bridges {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", b.ID, b.Addr, b.Port)
+	}
+	return w.Flush()
+}
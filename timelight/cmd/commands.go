@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aldld/hue/timelight"
+)
+
+func runRun(e *env, args []string) error {
+	flags := newFlags(e, "run")
+	dryRun := flags.Bool("dry-run", false, "log light and scene updates instead of sending them")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if _, err := e.validConfig(); err != nil {
+		return err
+	}
+	if *dryRun {
+		e.config.DryRun = true
+	}
+	tl, err := e.timelight()
+	if err != nil {
+		return err
+	}
+	tl.WatchConfig(e.configPath)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return tl.Run(ctx)
+}
+
+func runValidate(e *env, args []string) error {
+	if err := parseFlags(newFlags(e, "validate"), args); err != nil {
+		return err
+	}
+	if _, err := e.loadConfig(); err != nil {
+		return err
+	}
+
+	errs := 0
+	for _, p := range e.problems {
+		fmt.Fprintln(e.stdout, p.InFile(e.configPath))
+		if !p.Warning {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return configError{err: fmt.Errorf("%s: %d errors", e.configPath, errs)}
+	}
+
+	fmt.Fprintf(e.stdout, "%s: OK\n", e.configPath)
+	return nil
+}
+
+func runStatus(e *env, args []string) error {
+	if err := parseFlags(newFlags(e, "status"), args); err != nil {
+		return err
+	}
+	if _, err := e.validConfig(); err != nil {
+		return err
+	}
+	tl, err := e.timelight()
+	if err != nil {
+		return err
+	}
+
+	status, err := tl.Status(time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "Time:    %s\n", status.Time.Format(time.DateTime))
+	fmt.Fprintf(e.stdout, "Target:  brightness %.1f, mirek %d\n",
+		status.Target.Brightness, status.Target.TempMirek)
+	fmt.Fprintf(e.stdout, "Scenes:  %d timelight scenes\n\n", len(status.Scenes))
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tON\tBRIGHTNESS\tMIREK\tSCENES\tFOLLOWS TARGET")
+	for _, l := range status.Lights {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\t%d\t%v\n",
+			l.ID, l.Name, l.On,
+			brightnessString(l), mirekString(l),
+			l.Scenes, l.FollowsTarget(status.Target),
+		)
+	}
+	return w.Flush()
+}
+
+func runLights(e *env, args []string) error {
+	if err := parseFlags(newFlags(e, "lights"), args); err != nil {
+		return err
+	}
+	tl, err := e.timelight()
+	if err != nil {
+		return err
+	}
+
+	status, err := tl.Status(time.Now())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tDIMMABLE\tCOLOR TEMP\tCOLOR\tON\tBRIGHTNESS\tMIREK")
+	for _, l := range status.Lights {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%v\t%v\t%s\t%s\n",
+			l.ID, l.Name, l.HasBrightness, l.HasColorTemperature, l.HasColor, l.On,
+			brightnessString(l), mirekString(l),
+		)
+	}
+	return w.Flush()
+}
+
+func brightnessString(l timelight.LightStatus) string {
+	if !l.HasBrightness {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", l.Brightness)
+}
+
+func mirekString(l timelight.LightStatus) string {
+	if !l.HasColorTemperature || !l.MirekValid {
+		return "-"
+	}
+	return fmt.Sprintf("%d", l.Mirek)
+}
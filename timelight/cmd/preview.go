@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aldld/hue/timelight"
+)
+
+// previewPoint is the target state at a single point in time.
+type previewPoint struct {
+	Time       time.Time `json:"time"`
+	Brightness *float64  `json:"brightness,omitempty"`
+	Mirek      *int      `json:"mirek,omitempty"`
+	Color      string    `json:"color,omitempty"` // Approximate RGB of Mirek, as #rrggbb.
+}
+
+func runPreview(e *env, args []string) error {
+	flags := newFlags(e, "preview")
+	date := flags.String("date", "", "first date to preview, as YYYY-MM-DD (default today)")
+	to := flags.String("to", "", "last date to preview, as YYYY-MM-DD (default -date)")
+	step := flags.Duration("step", 30*time.Minute, "time between samples")
+	format := flags.String("format", "table", "output format (table, csv, json, svg)")
+	output := flags.String("o", "", "write to this file instead of stdout")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *step <= 0 {
+		return usageErrorf("-step must be positive")
+	}
+
+	write, ok := previewFormats[*format]
+	if !ok {
+		return usageErrorf("unknown -format %q", *format)
+	}
+
+	start, err := parseDate(*date, time.Now())
+	if err != nil {
+		return usageErrorf("invalid -date: %v", err)
+	}
+	last, err := parseDate(*to, start)
+	if err != nil {
+		return usageErrorf("invalid -to: %v", err)
+	}
+	if last.Before(start) {
+		return usageErrorf("-to must not be before -date")
+	}
+	end := last.AddDate(0, 0, 1)
+
+	// The bridge settings are not needed, so only the schedule has to be valid.
+	config, err := e.loadConfig()
+	if err != nil {
+		return err
+	}
+	spec, err := config.Timelight.Spec()
+	if err != nil {
+		return configError{err: err}
+	}
+
+	var points []previewPoint
+	for t := start; t.Before(end); t = t.Add(*step) {
+		points = append(points, newPreviewPoint(t, spec.TargetLightState(t)))
+	}
+
+	if *output == "" {
+		return write(e.stdout, points)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := write(f, points); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseDate parses a YYYY-MM-DD date in the local time zone, returning the start
+// of def's day if s is empty.
+func parseDate(s string, def time.Time) (time.Time, error) {
+	day := def
+	if s != "" {
+		var err error
+		day, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local), nil
+}
+
+func newPreviewPoint(t time.Time, target timelight.TargetState) previewPoint {
+	p := previewPoint{Time: t}
+	if target.HasBrightness {
+		b := target.Brightness
+		p.Brightness = &b
+	}
+	if target.HasTempMirek {
+		m := target.TempMirek
+		p.Mirek = &m
+		p.Color = mirekColor(m)
+	}
+	return p
+}
+
+var previewFormats = map[string]func(io.Writer, []previewPoint) error{
+	"table": writePreviewTable,
+	"csv":   writePreviewCSV,
+	"json":  writePreviewJSON,
+	"svg":   writePreviewSVG,
+}
+
+func writePreviewTable(w io.Writer, points []previewPoint) error {
+	// Only show dates if the preview spans more than one day.
+	layout := "15:04"
+	if len(points) > 0 && points[0].Time.YearDay() != points[len(points)-1].Time.YearDay() {
+		layout = "2006-01-02 15:04"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tBRIGHTNESS\tMIREK\tCOLOR")
+	for _, p := range points {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			p.Time.Format(layout), p.brightnessString(), p.mirekString(), orDash(p.Color))
+	}
+	return tw.Flush()
+}
+
+func writePreviewCSV(w io.Writer, points []previewPoint) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "brightness", "mirek", "color"})
+	for _, p := range points {
+		var brightness, mirek string
+		if p.Brightness != nil {
+			brightness = strconv.FormatFloat(*p.Brightness, 'f', 2, 64)
+		}
+		if p.Mirek != nil {
+			mirek = strconv.Itoa(*p.Mirek)
+		}
+		cw.Write([]string{p.Time.Format(time.RFC3339), brightness, mirek, p.Color})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writePreviewJSON(w io.Writer, points []previewPoint) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(points)
+}
+
+func (p previewPoint) brightnessString() string {
+	if p.Brightness == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", *p.Brightness)
+}
+
+func (p previewPoint) mirekString() string {
+	if p.Mirek == nil {
+		return "-"
+	}
+	return strconv.Itoa(*p.Mirek)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// mirekColor approximates the color of a black body at the given color
+// temperature, as #rrggbb. It uses Tanner Helland's fit of the CIE 1964 color
+// matching functions, which is good enough for display purposes.
+func mirekColor(mirek int) string {
+	if mirek <= 0 {
+		return ""
+	}
+	temp := 1e6 / float64(mirek) / 100
+
+	var r, g, b float64
+	if temp <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(temp) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(temp-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(temp-60, -0.0755148492)
+	}
+	switch {
+	case temp >= 66:
+		b = 255
+	case temp <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(temp-10) - 305.0447927307
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x", clampByte(r), clampByte(g), clampByte(b))
+}
+
+func clampByte(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(math.Round(v))
+}
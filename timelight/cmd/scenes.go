@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/aldld/hue/timelight"
+)
+
+type scenesCommand struct {
+	action string
+	all    bool   // list: include scenes that are not selected.
+	room   string // create: room to create the scene in.
+	name   string // create: name of the new scene; delete: ID or name of the scene.
+}
+
+func runScenes(e *env, args []string) error {
+	cmd, err := parseScenesCommand(e, args)
+	if err != nil {
+		return err
+	}
+	tl, err := e.timelight()
+	if err != nil {
+		return err
+	}
+	return cmd.run(e, tl)
+}
+
+// parseScenesCommand parses the arguments following "scenes".
+func parseScenesCommand(e *env, args []string) (*scenesCommand, error) {
+	cmd := &scenesCommand{action: "list"}
+	if len(args) >= 1 {
+		switch args[0] {
+		case "list", "create", "delete", "sync":
+			cmd.action = args[0]
+			args = args[1:]
+		}
+	}
+
+	flags := newFlags(e, "scenes "+cmd.action)
+	switch cmd.action {
+	case "list":
+		flags.BoolVar(&cmd.all, "all", false, "also list scenes that are not controlled by timelight")
+	case "create":
+		flags.StringVar(&cmd.room, "room", "", "name of the room to create the scene in")
+		flags.StringVar(&cmd.name, "name", "", "name of the new scene")
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+	args = flags.Args()
+
+	switch cmd.action {
+	case "create":
+		if cmd.room == "" {
+			return nil, usageErrorf("create: -room is required")
+		}
+	case "delete":
+		if len(args) != 1 {
+			return nil, usageErrorf("delete: expected a scene ID or name")
+		}
+		cmd.name = args[0]
+	default:
+		if len(args) != 0 {
+			return nil, usageErrorf("%s: unexpected arguments: %v", cmd.action, args)
+		}
+	}
+
+	return cmd, nil
+}
+
+func (c *scenesCommand) run(e *env, tl *timelight.Timelight) error {
+	switch c.action {
+	case "create":
+		created, err := tl.CreateScene(c.room, c.name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "Created scene %q (%s) in %s with %d lights\n",
+			created.Name, created.ID, created.Room, created.Lights)
+		if !created.Selected {
+			fmt.Fprintln(e.stdout, "Warning: the scene is not selected by the [scenes] configuration")
+		}
+		return nil
+
+	case "delete":
+		deleted, err := tl.DeleteScene(c.name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "Deleted scene %q (%s)\n", deleted.Name, deleted.ID)
+		return nil
+
+	case "sync":
+		return tl.SyncScenes()
+
+	default:
+		return listScenes(e.stdout, tl, c.all)
+	}
+}
+
+// listScenes prints the scenes on the bridge, and whether and why they are
+// controlled by timelight.
+func listScenes(out io.Writer, tl *timelight.Timelight, all bool) error {
+	matches, err := tl.MatchScenes()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tGROUP\tSELECTED\tREASON")
+	for _, m := range matches {
+		if !m.Matched && !all {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%s\n", m.ID, m.Name, m.Group, m.Matched, m.Reason)
+	}
+	return w.Flush()
+}
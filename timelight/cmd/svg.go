@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aldld/hue/timelight"
+)
+
+// Layout of the preview chart, in pixels.
+const (
+	svgWidth       = 960
+	svgPlotTop     = 20
+	svgPlotHeight  = 300
+	svgMarginLeft  = 60
+	svgMarginRight = 60
+	svgSwatchGap   = 30
+	svgSwatchSize  = 24
+	svgLabelHeight = 30
+
+	svgBrightnessColor = "#e0a000"
+	svgMirekColor      = "#3070d0"
+)
+
+// writePreviewSVG plots brightness (left axis) and color temperature (right axis)
+// over time, above a strip of swatches showing the color of each sample.
+func writePreviewSVG(w io.Writer, points []previewPoint) error {
+	bw := bufio.NewWriter(w)
+
+	plotWidth := float64(svgWidth - svgMarginLeft - svgMarginRight)
+	plotBottom := float64(svgPlotTop + svgPlotHeight)
+	swatchTop := plotBottom + svgSwatchGap
+	height := int(swatchTop) + svgSwatchSize + svgLabelHeight
+
+	var start, end time.Time
+	if len(points) > 0 {
+		start = points[0].Time
+		end = points[len(points)-1].Time
+	}
+	span := end.Sub(start).Seconds()
+	x := func(t time.Time) float64 {
+		if span <= 0 {
+			return svgMarginLeft
+		}
+		return svgMarginLeft + t.Sub(start).Seconds()/span*plotWidth
+	}
+	yBrightness := func(b float64) float64 {
+		return plotBottom - (b-timelight.MinBrightness)/(timelight.MaxBrightness-timelight.MinBrightness)*svgPlotHeight
+	}
+	yMirek := func(m int) float64 {
+		return plotBottom - float64(m-timelight.MinMirek)/float64(timelight.MaxMirek-timelight.MinMirek)*svgPlotHeight
+	}
+
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		svgWidth, height, svgWidth, height)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="white"/>`+"\n", svgWidth, height)
+
+	// Horizontal grid lines, labelled with both axes.
+	for i := 0; i <= 4; i++ {
+		frac := float64(i) / 4
+		y := plotBottom - frac*svgPlotHeight
+		brightness := timelight.MinBrightness + frac*(timelight.MaxBrightness-timelight.MinBrightness)
+		mirek := float64(timelight.MinMirek) + frac*float64(timelight.MaxMirek-timelight.MinMirek)
+		fmt.Fprintf(bw, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`+"\n",
+			svgMarginLeft, y, svgMarginLeft+plotWidth, y)
+		fmt.Fprintf(bw, `<text x="%d" y="%.1f" text-anchor="end" fill="%s">%.0f%%</text>`+"\n",
+			svgMarginLeft-6, y+4, svgBrightnessColor, brightness)
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" fill="%s">%.0f</text>`+"\n",
+			svgMarginLeft+plotWidth+6, y+4, svgMirekColor, mirek)
+	}
+
+	// Vertical grid lines at regular intervals.
+	tick := svgTickInterval(end.Sub(start))
+	layout := "15:04"
+	if tick >= 24*time.Hour {
+		layout = "Jan 2"
+	}
+	for t := start.Truncate(time.Hour); !t.After(end); t = t.Add(tick) {
+		if t.Before(start) {
+			continue
+		}
+		fmt.Fprintf(bw, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#eee"/>`+"\n",
+			x(t), svgPlotTop, x(t), plotBottom)
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n",
+			x(t), plotBottom+16, t.Format(layout))
+	}
+
+	fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="none" stroke="#999"/>`+"\n",
+		svgMarginLeft, svgPlotTop, plotWidth, svgPlotHeight)
+
+	// Brightness and color temperature lines.
+	fmt.Fprintf(bw, `<polyline fill="none" stroke="%s" stroke-width="2" points="`, svgBrightnessColor)
+	for _, p := range points {
+		if p.Brightness != nil {
+			fmt.Fprintf(bw, "%.1f,%.1f ", x(p.Time), yBrightness(*p.Brightness))
+		}
+	}
+	fmt.Fprintln(bw, `"/>`)
+	fmt.Fprintf(bw, `<polyline fill="none" stroke="%s" stroke-width="2" points="`, svgMirekColor)
+	for _, p := range points {
+		if p.Mirek != nil {
+			fmt.Fprintf(bw, "%.1f,%.1f ", x(p.Time), yMirek(*p.Mirek))
+		}
+	}
+	fmt.Fprintln(bw, `"/>`)
+
+	// Color swatches, one per sample.
+	swatchWidth := plotWidth
+	if len(points) > 0 {
+		swatchWidth = plotWidth / float64(len(points))
+	}
+	for i, p := range points {
+		color := p.Color
+		if color == "" {
+			color = "#ffffff"
+		}
+		fmt.Fprintf(bw, `<rect x="%.2f" y="%.1f" width="%.2f" height="%d" fill="%s"><title>%s: %s mirek</title></rect>`+"\n",
+			svgMarginLeft+float64(i)*swatchWidth, swatchTop, swatchWidth+0.5, svgSwatchSize, color,
+			p.Time.Format("2006-01-02 15:04"), p.mirekString())
+	}
+
+	// Legend.
+	legendY := int(swatchTop) + svgSwatchSize + 20
+	fmt.Fprintf(bw, `<text x="%d" y="%d" fill="%s">Brightness (%%)</text>`+"\n",
+		svgMarginLeft, legendY, svgBrightnessColor)
+	fmt.Fprintf(bw, `<text x="%d" y="%d" fill="%s">Color temperature (mirek)</text>`+"\n",
+		svgMarginLeft+120, legendY, svgMirekColor)
+
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// svgTickInterval picks a grid interval giving roughly 6 to 12 ticks.
+func svgTickInterval(span time.Duration) time.Duration {
+	for _, d := range []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour} {
+		if span/d <= 12 {
+			return d
+		}
+	}
+	days := time.Duration(1)
+	for span/(days*24*time.Hour) > 12 {
+		days *= 2
+	}
+	return days * 24 * time.Hour
+}
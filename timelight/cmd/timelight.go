@@ -1,36 +1,260 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
-	"time"
+	"strings"
 
-	"github.com/BurntSushi/toml"
-	"github.com/lmittmann/tint"
 	"golang.org/x/exp/slog"
 
 	"github.com/aldld/hue/timelight"
 )
 
+// Exit codes.
+const (
+	exitOK          = 0
+	exitFailure     = 1 // The command failed at runtime.
+	exitUsage       = 2 // The command line was invalid.
+	exitConfigError = 3 // The config file could not be read or is invalid.
+)
+
+// usageError is returned for invalid command lines.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func usageErrorf(format string, args ...any) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// configError is returned when the config file cannot be loaded.
+type configError struct{ err error }
+
+func (e configError) Error() string { return e.err.Error() }
+func (e configError) Unwrap() error { return e.err }
+
+// env holds the global options and lazily loaded state shared by all commands.
+type env struct {
+	configPath string
+	logLevel   string
+	logFormat  string
+
+	flags  *flag.FlagSet
+	stdout io.Writer
+	stderr io.Writer
+
+	config    *timelight.Config
+	problems  timelight.Problems
+	log       *slog.Logger
+	logCloser io.Closer
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(e *env, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "[-dry-run]", "Run the timelight daemon", runRun},
+		{"validate", "", "Check the config file for errors", runValidate},
+		{"preview", "[-date YYYY-MM-DD] [-to YYYY-MM-DD] [-step duration] [-format table|csv|json|svg] [-o file]", "Print or plot the schedule for a day or range of days", runPreview},
+		{"status", "", "Compare the bridge's lights against the current target", runStatus},
+		{"lights", "", "List the lights on the bridge", runLights},
+		{"scenes", "[list|create|delete|sync] ...", "Manage timelight scenes", runScenes},
+		{"pair", "[-addr host] [-name devicetype]", "Pair with a bridge and print its credentials", runPair},
+		{"discover", "", "Find bridges on the local network", runDiscover},
+		{"help", "", "Show this help", runHelp},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
 func main() {
-	args := os.Args
-	configFilename := "config.toml"
-	if len(args) >= 2 {
-		configFilename = args[len(args)-1]
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	e := &env{stdout: stdout, stderr: stderr}
+
+	flags := flag.NewFlagSet("timelight", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&e.configPath, "config", "config.toml", "path to the config file")
+	flags.StringVar(&e.logLevel, "log-level", "", "log level (debug, info, warn, error); overrides the config file")
+	flags.StringVar(&e.logFormat, "log-format", "", "log format (text, logfmt, json); overrides the config file")
+	flags.Usage = func() { printUsage(stderr, flags) }
+	e.flags = flags
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
 	}
+	args = flags.Args()
 
-	var config timelight.Config
-	if _, err := toml.DecodeFile(configFilename, &config); err != nil {
-		panic(err)
+	name := "run"
+	if len(args) >= 1 {
+		name = args[0]
+		args = args[1:]
+	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		if strings.HasSuffix(name, ".toml") && len(args) == 0 {
+			// Older versions took the config path as the only argument.
+			e.configPath = name
+			cmd, _ = findCommand("run")
+		} else {
+			fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+			printUsage(stderr, flags)
+			return exitUsage
+		}
 	}
 
-	log := slog.New(tint.NewHandler(os.Stdout, &tint.Options{
-		Level:      config.Logger.SlogLevel(),
-		TimeFormat: time.TimeOnly,
-	}))
+	err := cmd.run(e, args)
+	if e.logCloser != nil {
+		defer e.logCloser.Close()
+	}
+	var usageErr usageError
+	var configErr configError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "%s: %v\n", cmd.name, err)
+		return exitUsage
+	case errors.As(err, &configErr):
+		fmt.Fprintf(stderr, "config error: %v\n", err)
+		return exitConfigError
+	default:
+		if e.log != nil {
+			e.log.Error("command failed", slog.String("command", cmd.name), slog.Any("err", err))
+		} else {
+			fmt.Fprintf(stderr, "%s: %v\n", cmd.name, err)
+		}
+		return exitFailure
+	}
+}
+
+func printUsage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: timelight [global flags] <command> [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	flags.PrintDefaults()
+}
+
+func runHelp(e *env, args []string) error {
+	if len(args) == 1 {
+		if cmd, ok := findCommand(args[0]); ok {
+			fmt.Fprintf(e.stdout, "Usage: timelight %s %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+			return nil
+		}
+	}
+	e.flags.SetOutput(e.stdout)
+	printUsage(e.stdout, e.flags)
+	return nil
+}
+
+// newFlags returns a flag set for a command. Parse it with parseFlags, so that
+// invalid flags are reported as usage errors.
+func newFlags(e *env, name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	return flags
+}
+
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{msg: err.Error()}
+	}
+	return nil
+}
+
+// loadConfig reads the config file and sets up the logger. Problems found while
+// validating the config are stored in e.problems; use validConfig to require a
+// valid config.
+func (e *env) loadConfig() (timelight.Config, error) {
+	if e.config != nil {
+		return *e.config, nil
+	}
+
+	config, problems, err := timelight.LoadConfig(e.configPath)
+	if err != nil {
+		return config, configError{err: err}
+	}
+	if e.logLevel != "" {
+		config.Logger.Level = e.logLevel
+	}
+	if e.logFormat != "" {
+		config.Logger.Format = e.logFormat
+	}
+
+	// If the logger config is invalid, fall back to a logger configured only by
+	// the command line, so that the problem can still be reported.
+	log, closer, err := config.Logger.NewLogger(e.stdout, e.stderr)
+	if err != nil {
+		fallback := timelight.LoggerConfig{Level: e.logLevel, Format: e.logFormat}
+		log, closer, err = fallback.NewLogger(e.stdout, e.stderr)
+		if err != nil {
+			return config, usageError{msg: err.Error()}
+		}
+	}
+
+	e.config = &config
+	e.problems = problems
+	e.log = log
+	e.logCloser = closer
+	return config, nil
+}
+
+// validConfig loads the config file, logs any warnings and fails if it contains
+// errors.
+func (e *env) validConfig() (timelight.Config, error) {
+	config, err := e.loadConfig()
+	if err != nil {
+		return config, err
+	}
+	if err := e.problems.Err(); err != nil {
+		return config, configError{err: err}
+	}
+	for _, p := range e.problems {
+		e.log.Warn("config warning",
+			slog.String("key", p.Key),
+			slog.Int("line", p.Line),
+			slog.String("problem", p.Message),
+		)
+	}
+	return config, nil
+}
 
-	tl := timelight.New(log, config)
-	if err := tl.Run(); err != nil {
-		log.Error("timelight errored", slog.Any("err", err))
-		os.Exit(1)
+func (e *env) timelight() (*timelight.Timelight, error) {
+	config, err := e.loadConfig()
+	if err != nil {
+		return nil, err
 	}
+	return timelight.New(e.log, config), nil
 }
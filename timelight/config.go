@@ -1,9 +1,12 @@
 package timelight
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/exp/slog"
 )
@@ -12,24 +15,80 @@ type Config struct {
 	Logger    LoggerConfig    `toml:"logger"`
 	Bridge    BridgeConfig    `toml:"bridge"`
 	Timelight TimelightConfig `toml:"timelight"`
+	Scenes    SceneConfig     `toml:"scenes"`
+	Shutdown  ShutdownConfig  `toml:"shutdown"`
+	HTTP      HTTPConfig      `toml:"http"`
+	MQTT      MQTTConfig      `toml:"mqtt"`
+	Webhooks  []WebhookConfig `toml:"webhooks"`
+	Motion    []MotionConfig  `toml:"motion"`
+
+	NightLight *NightLightConfig `toml:"night_light"`
+	Alarms     []AlarmConfig     `toml:"alarms"`
+
+	Bindings []BindingConfig `toml:"bindings"`
+	Bias     BiasConfig      `toml:"bias"`
+
+	// Holidays are dates, e.g. "2026-12-25", on which alarms don't ring.
+	Holidays []string `toml:"holidays"`
+
+	// Profiles are alternative schedules which can be switched to at runtime.
+	// The schedule in [timelight] is the profile named "default".
+	Profiles map[string]TimelightConfig `toml:"profiles"`
+
+	// DryRun logs light and scene updates instead of sending them to the bridge.
+	DryRun bool `toml:"dry_run"`
 }
 
 type LoggerConfig struct {
-	Level string `toml:"level"`
+	Level  string          `toml:"level"`  // Default level; info if empty.
+	Levels ComponentLevels `toml:"levels"` // Overrides Level for individual components.
+
+	// Format is "text", "logfmt" or "json"; text if empty. Text is colored when
+	// written to a terminal.
+	Format string `toml:"format"`
+
+	// Output is "stdout", "stderr" or the path of a file; stdout if empty. Files
+	// are rotated once they reach MaxSizeMB, keeping MaxFiles old files.
+	Output    string `toml:"output"`
+	MaxSizeMB int    `toml:"max_size_mb"`
+	MaxFiles  int    `toml:"max_files"`
 }
 
-func (c LoggerConfig) SlogLevel() slog.Level {
-	switch strings.ToLower(c.Level) {
+// ComponentLevels sets the log level of each component.
+type ComponentLevels struct {
+	Hue  string `toml:"hue"`  // The hue client.
+	Core string `toml:"core"` // Everything else.
+}
+
+// SlogLevel returns the default level, or an error if it is not one of debug,
+// info, warn or error.
+func (c LoggerConfig) SlogLevel() (slog.Level, error) {
+	return parseLevel(c.Level, slog.LevelInfo)
+}
+
+// componentLevel returns the level of a component, which defaults to Level.
+func (c LoggerConfig) componentLevel(level string) (slog.Level, error) {
+	def, err := c.SlogLevel()
+	if err != nil {
+		return def, err
+	}
+	return parseLevel(level, def)
+}
+
+func parseLevel(level string, def slog.Level) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "":
+		return def, nil
 	case "debug":
-		return slog.LevelDebug
+		return slog.LevelDebug, nil
 	case "info":
-		return slog.LevelInfo
+		return slog.LevelInfo, nil
 	case "warn":
-		return slog.LevelWarn
+		return slog.LevelWarn, nil
 	case "error":
-		return slog.LevelError
+		return slog.LevelError, nil
 	default:
-		return slog.LevelInfo
+		return def, fmt.Errorf("unknown log level %q", level)
 	}
 }
 
@@ -38,6 +97,60 @@ type BridgeConfig struct {
 	Username string `toml:"username"`
 }
 
+// HTTPConfig configures the status and control API, which also serves metrics.
+type HTTPConfig struct {
+	Addr string `toml:"addr"` // Address to listen on, e.g. "127.0.0.1:8080". Disabled if empty.
+}
+
+// MQTTConfig configures publishing state to, and receiving commands from, an
+// MQTT broker.
+type MQTTConfig struct {
+	Broker      string `toml:"broker"` // e.g. "tcp://localhost:1883". Disabled if empty.
+	ClientID    string `toml:"client_id"`
+	Username    string `toml:"username"`
+	Password    string `toml:"password"`
+	TopicPrefix string `toml:"topic_prefix"` // "timelight" if empty.
+
+	// Discovery announces timelight's entities to Home Assistant, under
+	// DiscoveryPrefix ("homeassistant" if empty).
+	Discovery       bool   `toml:"discovery"`
+	DiscoveryPrefix string `toml:"discovery_prefix"`
+}
+
+// SceneConfig selects the scenes that timelight keeps up to date. A scene is
+// selected if it matches any of the criteria.
+type SceneConfig struct {
+	IDs          []string `toml:"ids"`           // Scene IDs.
+	Rooms        []string `toml:"rooms"`         // Names of rooms, matched case-insensitively.
+	Zones        []string `toml:"zones"`         // Names of zones, matched case-insensitively.
+	NamePatterns []string `toml:"name_patterns"` // Regular expressions matched against scene names.
+	AppData      string   `toml:"appdata"`       // Marker stored in the scene's app data.
+}
+
+// ShutdownConfig controls what happens when timelight is asked to exit.
+type ShutdownConfig struct {
+	// Timeout is how long to wait for pending light updates before cancelling
+	// them, e.g. "10s".
+	Timeout string `toml:"timeout"`
+
+	// StateFile is where the state of each light is saved on exit, and restored
+	// from on startup if it is recent enough.
+	StateFile string `toml:"state_file"`
+
+	// Restore, if set, is the state active lights are set to on exit.
+	Restore *StateConfig `toml:"restore"`
+}
+
+const defaultShutdownTimeout = 10 * time.Second
+
+func (c ShutdownConfig) timeout() time.Duration {
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil || d <= 0 {
+		return defaultShutdownTimeout
+	}
+	return d
+}
+
 type StateConfig struct {
 	Brightness     *float64 `toml:"brightness,omitempty"`
 	ColorTempMirek *int     `toml:"color_temp_mirek,omitempty"`
@@ -78,6 +191,32 @@ func (c StateConfig) TargetState() TargetState {
 	return state
 }
 
+const DefaultProfile = "default"
+
+var errUnknownProfile = errors.New("unknown profile")
+
+// ProfileNames returns the names of every profile, starting with the default.
+func (c Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles)+1)
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfile}, names...)
+}
+
+// ProfileSpec returns the schedule of the named profile.
+func (c Config) ProfileSpec(name string) (Spec, error) {
+	if name == DefaultProfile || name == "" {
+		return c.Timelight.Spec()
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownProfile, name)
+	}
+	return profile.Spec()
+}
+
 type TimelightConfig struct {
 	Brightness TransitionConfig `toml:"brightness"`
 	ColorTemp  TransitionConfig `toml:"color_temp"`
@@ -124,6 +263,10 @@ func (c TransitionConfig) spec() (SmoothTransition, error) {
 		return empty, err
 	}
 
+	if err := checkTransitionOrder(startTime, transitionTime, endTime); err != nil {
+		return empty, err
+	}
+
 	return SmoothTransition{
 		StartMinute:      startTime,
 		TransitionMinute: transitionTime,
@@ -142,12 +285,30 @@ func parseMinuteOfDay(s string) (int, error) {
 
 	hour, err := strconv.Atoi(parts[0])
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("invalid time: %s", s)
 	}
 	minute, err := strconv.Atoi(parts[1])
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("invalid time: %s", s)
+	}
+	if hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid time: %s: hour must be between 0 and 23", s)
+	}
+	if minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time: %s: minute must be between 0 and 59", s)
 	}
 
 	return 60*hour + minute, nil
 }
+
+// checkTransitionOrder checks that a transition's times are in order within a
+// day, and that the transition itself has a non-zero length.
+func checkTransitionOrder(start, transition, end int) error {
+	if start > transition {
+		return fmt.Errorf("start_time must not be after transition_time")
+	}
+	if transition >= end {
+		return fmt.Errorf("transition_time must be before end_time")
+	}
+	return nil
+}
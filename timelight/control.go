@@ -0,0 +1,180 @@
+package timelight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aldld/hue/hue"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	recentEventsSize = 50
+)
+
+var (
+	// errNotRunning is returned for commands sent when the main loop is not running.
+	errNotRunning = errors.New("timelight is not running")
+
+	errLightNotFound = errors.New("light not found")
+)
+
+// do runs f on the main loop, which owns the state of lights and scenes, and
+// waits for it to finish.
+func (t *Timelight) do(ctx context.Context, f func(t *Timelight) error) error {
+	done := make(chan error, 1)
+	cmd := func(t *Timelight) { done <- f(t) }
+
+	select {
+	case t.commands <- cmd:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.stopped:
+		return errNotRunning
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause stops timelight from updating lights and scenes until the given time,
+// or until Resume is called if until is zero. Events are still handled.
+func (t *Timelight) Pause(until time.Time) {
+	t.paused = true
+	t.pausedUntil = until
+	if until.IsZero() {
+		t.log.Info("paused")
+	} else {
+		t.log.Info("paused", slog.Time("until", until))
+	}
+}
+
+// Resume undoes Pause.
+func (t *Timelight) Resume() {
+	if !t.paused {
+		return
+	}
+	t.paused = false
+	t.pausedUntil = time.Time{}
+	t.log.Info("resumed")
+}
+
+func (t *Timelight) isPaused(now time.Time) bool {
+	if t.paused && !t.pausedUntil.IsZero() && !now.Before(t.pausedUntil) {
+		t.Resume()
+	}
+	return t.paused
+}
+
+// SetProfile switches to the schedule of the named profile, and updates lights
+// and scenes to match it.
+func (t *Timelight) SetProfile(name string) error {
+	spec, err := t.config.ProfileSpec(name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	t.spec = spec
+	t.profile = name
+	t.log.Info("switched profile", slog.String("profile", name))
+
+	t.runLightUpdate(time.Now(), t.spec)
+	return nil
+}
+
+// activateLights marks the lights as controlled by timelight and brings them to
+// the current target state.
+func (t *Timelight) activateLights(now time.Time, ids []LightID) error {
+	target := t.spec.TargetLightState(now)
+	for _, id := range ids {
+		light, ok := t.lights[id]
+		if !ok {
+			return fmt.Errorf("%w: %s", errLightNotFound, id)
+		}
+		light.SetActive()
+		delete(t.pathLights, id)
+		// Forget the previous target, so that the update is sent even if it has
+		// not changed since the light was deactivated.
+		light.TargetState = TargetState{}
+		if err := light.Update(now, t.lightTarget(light, now, target), 2*time.Second); err != nil {
+			return err
+		}
+	}
+	t.log.Info("activated lights", slog.Int("count", len(ids)))
+	return nil
+}
+
+// deactivateLights stops timelight from controlling the lights until they are
+// activated again.
+func (t *Timelight) deactivateLights(ids []LightID) error {
+	for _, id := range ids {
+		light, ok := t.lights[id]
+		if !ok {
+			return fmt.Errorf("%w: %s", errLightNotFound, id)
+		}
+		light.SetInactive()
+	}
+	t.log.Info("deactivated lights", slog.Int("count", len(ids)))
+	return nil
+}
+
+// roomLightIDs returns the IDs of the tracked lights in the named room.
+func (t *Timelight) roomLightIDs(name string) ([]LightID, error) {
+	room, err := t.findRoom(name)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := t.roomLights(room)
+	if err != nil {
+		return nil, err
+	}
+
+	var lights []LightID
+	for _, id := range ids {
+		if _, ok := t.lights[LightID(id)]; ok {
+			lights = append(lights, LightID(id))
+		}
+	}
+	return lights, nil
+}
+
+// RecentEvent summarizes an event received from the bridge.
+type RecentEvent struct {
+	ID        string            `json:"id"`
+	Time      time.Time         `json:"time"`
+	Type      string            `json:"type"`
+	Resources []hue.ResourceRef `json:"resources"`
+}
+
+// recordEvent adds the event to the ring buffer of recent events.
+func (t *Timelight) recordEvent(event hue.Event) {
+	recent := RecentEvent{
+		ID:   event.ID,
+		Time: event.CreationTime,
+		Type: event.Type,
+	}
+	for _, raw := range event.Raw {
+		var header struct {
+			ID   string           `json:"id"`
+			Type hue.ResourceType `json:"type"`
+		}
+		if err := json.Unmarshal(raw, &header); err == nil {
+			recent.Resources = append(recent.Resources, hue.ResourceRef{ID: header.ID, Type: header.Type})
+		}
+	}
+
+	if len(t.recentEvents) < recentEventsSize {
+		t.recentEvents = append(t.recentEvents, recent)
+	} else {
+		copy(t.recentEvents, t.recentEvents[1:])
+		t.recentEvents[len(t.recentEvents)-1] = recent
+	}
+}
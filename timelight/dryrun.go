@@ -0,0 +1,142 @@
+package timelight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aldld/hue/hue"
+	"golang.org/x/exp/slog"
+)
+
+// dryRun logs the updates timelight would make instead of sending them. It keeps
+// a cache of the bridge's resources, fed by the event stream, so that each update
+// can be compared against the current state of the bridge.
+type dryRun struct {
+	log   *slog.Logger
+	cache *hue.Cache
+}
+
+func newDryRun(log *slog.Logger, c *hue.Client) *dryRun {
+	return &dryRun{
+		log:   log,
+		cache: hue.NewCache(c),
+	}
+}
+
+func (d *dryRun) updateLight(id LightID, update hue.LightUpdate) {
+	var diff []string
+	if current, ok := hue.Lookup[hue.Light](d.cache.Snapshot(), string(id)); ok {
+		diff = lightDiff(current, update)
+	}
+	d.log.Info("dry run: not updating light",
+		slog.String("id", string(id)),
+		slog.String("payload", payload(update)),
+		slog.Any("diff", diff),
+	)
+}
+
+func (d *dryRun) updateScene(id SceneID, update hue.SceneUpdate) {
+	var diff []string
+	if current, ok := hue.Lookup[hue.Scene](d.cache.Snapshot(), string(id)); ok && update.Actions != nil {
+		diff = sceneDiff(current, *update.Actions)
+	}
+	d.log.Info("dry run: not updating scene",
+		slog.String("id", string(id)),
+		slog.String("payload", payload(update)),
+		slog.Any("diff", diff),
+	)
+}
+
+func payload(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return string(data)
+}
+
+// lightDiff describes how the update would change the light.
+func lightDiff(current hue.Light, update hue.LightUpdate) []string {
+	var diff []string
+	if update.On != nil {
+		on := current.On != nil && current.On.On
+		if on != update.On.On {
+			diff = append(diff, fmt.Sprintf("on: %v -> %v", on, update.On.On))
+		}
+	}
+	if update.Dimming != nil && current.Dimming != nil {
+		if !within(current.Dimming.Brightness, update.Dimming.Brightness, 0.5) {
+			diff = append(diff, fmt.Sprintf("brightness: %.1f -> %.1f",
+				current.Dimming.Brightness, update.Dimming.Brightness))
+		}
+	}
+	if update.Color != nil && current.Color != nil {
+		if !within(current.Color.XY.X, update.Color.XY.X, 0.001) || !within(current.Color.XY.Y, update.Color.XY.Y, 0.001) {
+			diff = append(diff, fmt.Sprintf("xy: [%.3f, %.3f] -> [%.3f, %.3f]",
+				current.Color.XY.X, current.Color.XY.Y, update.Color.XY.X, update.Color.XY.Y))
+		}
+	}
+	if update.ColorTemperature != nil && current.ColorTemperature != nil {
+		if !current.ColorTemperature.MirekValid {
+			diff = append(diff, fmt.Sprintf("mirek: invalid -> %d", update.ColorTemperature.Mirek))
+		} else if current.ColorTemperature.Mirek != update.ColorTemperature.Mirek {
+			diff = append(diff, fmt.Sprintf("mirek: %d -> %d",
+				current.ColorTemperature.Mirek, update.ColorTemperature.Mirek))
+		}
+	}
+	return diff
+}
+
+// sceneDiff describes how the actions would change the scene, per light.
+func sceneDiff(current hue.Scene, actions []hue.SceneAction) []string {
+	old := make(map[string]hue.Action, len(current.Actions))
+	for _, a := range current.Actions {
+		old[a.Target.ID] = a.Action
+	}
+
+	var diff []string
+	for _, a := range actions {
+		if a.Target.ID == "" {
+			continue
+		}
+		prev, ok := old[a.Target.ID]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("%s: added", a.Target.ID))
+			continue
+		}
+		if prev.Dimming != nil && a.Action.Dimming != nil &&
+			!within(prev.Dimming.Brightness, a.Action.Dimming.Brightness, 0.5) {
+			diff = append(diff, fmt.Sprintf("%s: brightness: %.1f -> %.1f",
+				a.Target.ID, prev.Dimming.Brightness, a.Action.Dimming.Brightness))
+		}
+		if prev.ColorTemperature != nil && a.Action.ColorTemperature != nil &&
+			prev.ColorTemperature.Mirek != a.Action.ColorTemperature.Mirek {
+			diff = append(diff, fmt.Sprintf("%s: mirek: %d -> %d",
+				a.Target.ID, prev.ColorTemperature.Mirek, a.Action.ColorTemperature.Mirek))
+		}
+	}
+	return diff
+}
+
+// listen keeps the cache up to date and forwards the events timelight handles
+// to out, until ctx is done.
+func (d *dryRun) listen(ctx context.Context, out chan<- hue.Event) {
+	events := make(chan hue.Event, 8)
+	go d.cache.Run(ctx, events)
+	for {
+		select {
+		case event := <-events:
+			if !filterEvent(event) {
+				continue
+			}
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
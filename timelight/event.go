@@ -20,6 +20,7 @@ func (t *Timelight) handleEvent(event hue.Event) {
 		slog.Time("creation_time", event.CreationTime),
 	)
 	t.lastEventId = event.LastEventID
+	t.recordEvent(event)
 
 	switch event.Type {
 	case "update":
@@ -27,6 +28,16 @@ func (t *Timelight) handleEvent(event hue.Event) {
 			t.handleUpdate(resource, event.CreationTime)
 		}
 
+	case "add":
+		for _, resource := range event.Data {
+			t.handleAdd(resource)
+		}
+
+	case "delete":
+		for _, resource := range event.Data {
+			t.handleDelete(resource)
+		}
+
 	default:
 		t.log.Debug("unknown event type", slog.String("type", event.Type))
 	}
@@ -46,6 +57,24 @@ func (t *Timelight) handleUpdate(res hue.Resource, eventTime time.Time) {
 		}
 		t.handleLightUpdate(*r, eventTime)
 
+	case *hue.Motion:
+		if r == nil {
+			return
+		}
+		t.handleMotion(*r, eventTime)
+
+	case *hue.Button:
+		if r == nil {
+			return
+		}
+		t.handleButton(*r, eventTime)
+
+	case *hue.RelativeRotary:
+		if r == nil {
+			return
+		}
+		t.handleRotary(*r, eventTime)
+
 	default:
 		t.log.Debug("unkown resource type",
 			slog.String("type", fmt.Sprintf("%T", res)),
@@ -54,6 +83,57 @@ func (t *Timelight) handleUpdate(res hue.Resource, eventTime time.Time) {
 	}
 }
 
+func (t *Timelight) handleAdd(res hue.Resource) {
+	switch r := res.(type) {
+	case *hue.Scene:
+		if r == nil || !t.isTimelightScene(*r) {
+			return
+		}
+		t.addScene(*r)
+
+	case *hue.Light:
+		if r == nil {
+			return
+		}
+		if _, found := t.lights[LightID(r.ID)]; found {
+			return
+		}
+		light := t.newLight(*r)
+		t.lights[light.ID] = light
+
+		// Scenes may already target the light if they were created first.
+		for _, scene := range t.scenes {
+			if scene.hasLight(light.ID) {
+				scene.Lights[light.ID] = light
+			}
+		}
+		t.log.Info("added light", slog.String("id", string(light.ID)))
+	}
+}
+
+func (t *Timelight) handleDelete(res hue.Resource) {
+	switch r := res.(type) {
+	case *hue.Scene:
+		if r == nil {
+			return
+		}
+		if _, found := t.scenes[SceneID(r.ID)]; !found {
+			return
+		}
+		delete(t.scenes, SceneID(r.ID))
+		t.log.Info("removed scene", slog.String("id", r.ID))
+
+	case *hue.Light:
+		if r == nil {
+			return
+		}
+		if _, found := t.lights[LightID(r.ID)]; !found {
+			return
+		}
+		t.removeLight(LightID(r.ID))
+	}
+}
+
 func (t *Timelight) handleSceneUpdate(scene hue.Scene) {
 	tlScene, found := t.scenes[SceneID(scene.ID)]
 	if !found {
@@ -62,7 +142,12 @@ func (t *Timelight) handleSceneUpdate(scene hue.Scene) {
 		// affected.
 	}
 
-	// TODO: Detect whether lights were added to/removed from scene?
+	if len(scene.Actions) != 0 {
+		// Lights may have been added to or removed from the scene.
+		tlScene.Hue.Actions = scene.Actions
+		tlScene.linkLights()
+	}
+
 	if scene.Status == nil {
 		return // Does this mean scene was not recalled?
 	}
@@ -89,11 +174,34 @@ func (t *Timelight) handleLightUpdate(lightUpdate hue.Light, eventTime time.Time
 	if !found {
 		return
 	}
+	if lightUpdate.On != nil {
+		if tlLight.expectsPower(lightUpdate.On.On, eventTime) {
+			tlLight.On = lightUpdate.On.On
+			return // Timelight switched the light itself.
+		}
+		if lightUpdate.On.On && !tlLight.On && t.handlePowerOn(tlLight, eventTime) {
+			return
+		}
+		tlLight.On = lightUpdate.On.On
+	}
 	if !tlLight.Active {
 		return // Light is not active; this method won't change it.
 	}
+	if _, ok := t.wakeLights[tlLight.ID]; ok {
+		if lightUpdate.On == nil || lightUpdate.On.On {
+			return // The bridge reports intermediate states while ramping up.
+		}
+		delete(t.wakeLights, tlLight.ID)
+	}
 
 	if lightChanged(tlLight, lightUpdate, eventTime) {
+		if t.biasFromManualChange(tlLight, lightUpdate, eventTime) {
+			t.log.Info("change detected, following the schedule with a bias",
+				slog.String("id", string(tlLight.ID)),
+				slog.Any("target", tlLight.TargetState),
+			)
+			return
+		}
 		t.log.Info("changed detected",
 			slog.String("id", string(tlLight.ID)),
 			slog.Any("target", tlLight.TargetState),
@@ -101,6 +209,10 @@ func (t *Timelight) handleLightUpdate(lightUpdate hue.Light, eventTime time.Time
 			slog.Any("update_temp", lightUpdate.ColorTemperature),
 		)
 		tlLight.SetInactive()
+		t.metrics.override()
+		t.publishOverride(tlLight, eventTime)
+		t.fireWebhooks(WebhookOverride, "light was changed manually",
+			map[string]any{"light": tlLight.ID, "target": tlLight.TargetState})
 	}
 }
 
@@ -124,6 +236,12 @@ func lightChanged(light *Light, lightUpdate hue.Light, eventTime time.Time) bool
 		}
 	}
 
+	if light.HasColor && target.HasColor {
+		// The bridge reports the color temperature as invalid while it shows a
+		// color, so there is nothing more to compare.
+		return false
+	}
+
 	if light.HasColorTemperature && lightUpdate.ColorTemperature != nil && target.HasTempMirek {
 		if !lightUpdate.ColorTemperature.MirekValid {
 			return true
@@ -0,0 +1,172 @@
+package timelight
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultDiscoveryPrefix = "homeassistant"
+)
+
+// roomActive reports whether timelight controls every light in the room.
+func (t *Timelight) roomActive(room roomInfo) bool {
+	for _, id := range room.Lights {
+		if l, ok := t.lights[id]; !ok || !l.Active {
+			return false
+		}
+	}
+	return len(room.Lights) > 0
+}
+
+func (t *Timelight) publishRooms() {
+	for _, room := range t.rooms {
+		state := "OFF"
+		if t.roomActive(room) {
+			state = "ON"
+		}
+		t.mqtt.publish("rooms/"+room.ID+"/active", []byte(state))
+	}
+}
+
+func (t *Timelight) handleRoomSwitch(ctx context.Context, id, payload string) {
+	payload = strings.TrimSpace(payload)
+	t.log.Info("received room switch", slog.String("room", id), slog.String("state", payload))
+
+	ctx, cancel := context.WithTimeout(ctx, mqttCommandTimeout)
+	defer cancel()
+
+	err := t.do(ctx, func(t *Timelight) error {
+		room, ok := t.rooms[id]
+		if !ok {
+			return fmt.Errorf("%w: %s", errRoomNotFound, id)
+		}
+		switch strings.ToUpper(payload) {
+		case "ON":
+			return t.activateLights(time.Now(), room.Lights)
+		case "OFF":
+			return t.deactivateLights(room.Lights)
+		default:
+			return fmt.Errorf("invalid state %q", payload)
+		}
+	})
+	if err != nil {
+		t.log.Error("room switch failed", slog.String("room", id), slog.Any("err", err))
+	}
+}
+
+// haDevice groups timelight's entities in Home Assistant.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+type haAvailability struct {
+	Topic string `json:"topic"`
+}
+
+// haEntity holds the discovery fields used by timelight's entities. See
+// https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery.
+type haEntity struct {
+	Name             string           `json:"name"`
+	UniqueID         string           `json:"unique_id"`
+	ObjectID         string           `json:"object_id,omitempty"`
+	Device           haDevice         `json:"device"`
+	Availability     []haAvailability `json:"availability"`
+	AvailabilityMode string           `json:"availability_mode"`
+	StateTopic       string           `json:"state_topic"`
+	ValueTemplate    string           `json:"value_template,omitempty"`
+	CommandTopic     string           `json:"command_topic,omitempty"`
+	Options          []string         `json:"options,omitempty"`
+	UnitOfMeasure    string           `json:"unit_of_measurement,omitempty"`
+	StateClass       string           `json:"state_class,omitempty"`
+	Icon             string           `json:"icon,omitempty"`
+}
+
+// publishDiscovery announces timelight's entities to Home Assistant: a switch for
+// each room, sensors for the target state and a select for the profile. They
+// are available while both timelight and its bridge connection are up.
+// Entities announced earlier which no longer exist, e.g. deleted rooms, are
+// removed.
+func (t *Timelight) publishDiscovery() {
+	b := t.mqtt
+	if b == nil || b.discoveryPrefix == "" {
+		return
+	}
+
+	device := haDevice{
+		Identifiers:  []string{b.clientID},
+		Name:         "Timelight",
+		Manufacturer: "timelight",
+	}
+	entity := func(name, id string) haEntity {
+		return haEntity{
+			Name:     name,
+			UniqueID: b.clientID + "_" + id,
+			Device:   device,
+			Availability: []haAvailability{
+				{Topic: b.topic("status")},
+				{Topic: b.topic("bridge")},
+			},
+			AvailabilityMode: "all",
+		}
+	}
+	announced := make(map[string]bool)
+	publish := func(component, id string, e haEntity) {
+		topic := fmt.Sprintf("%s/%s/%s/%s/config", b.discoveryPrefix, component, b.clientID, id)
+		b.publishJSONTo(topic, e)
+		announced[topic] = true
+	}
+
+	brightness := entity("Target brightness", "target_brightness")
+	brightness.StateTopic = b.topic("target")
+	brightness.ValueTemplate = "{{ value_json.target.brightness | round(1) }}"
+	brightness.UnitOfMeasure = "%"
+	brightness.StateClass = "measurement"
+	brightness.Icon = "mdi:brightness-6"
+	publish("sensor", "target_brightness", brightness)
+
+	temp := entity("Target color temperature", "target_mirek")
+	temp.StateTopic = b.topic("target")
+	temp.ValueTemplate = "{{ value_json.target.temp_mirek }}"
+	temp.UnitOfMeasure = "mired"
+	temp.StateClass = "measurement"
+	temp.Icon = "mdi:thermometer"
+	publish("sensor", "target_mirek", temp)
+
+	profile := entity("Profile", "profile")
+	profile.StateTopic = b.topic("target")
+	profile.ValueTemplate = "{{ value_json.profile }}"
+	profile.CommandTopic = b.topic("cmd/profile")
+	profile.Options = t.config.ProfileNames()
+	profile.Icon = "mdi:calendar-clock"
+	publish("select", "profile", profile)
+
+	for _, room := range t.rooms {
+		id := "room_" + room.ID
+		sw := entity(room.Name+" timelight", id)
+		sw.StateTopic = b.topic("rooms/" + room.ID + "/active")
+		sw.CommandTopic = b.topic("rooms/" + room.ID + "/set")
+		sw.Icon = "mdi:home-lightbulb"
+		publish("switch", id, sw)
+	}
+
+	b.mu.Lock()
+	var stale []string
+	for topic := range b.announced {
+		if !announced[topic] {
+			stale = append(stale, topic)
+		}
+	}
+	b.announced = announced
+	b.mu.Unlock()
+
+	for _, topic := range stale {
+		b.clear(topic)
+	}
+}
@@ -2,6 +2,8 @@ package timelight
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aldld/hue/hue"
@@ -18,16 +20,42 @@ const (
 type LightID string
 
 type Light struct {
-	h *hue.Client
+	h   *hue.Client
+	dry *dryRun // If set, updates are logged instead of sent.
 
 	ID                  LightID
 	Active              bool // Is Timelight currently controlling this light?
+	On                  bool
 	HasColor            bool
 	HasColorTemperature bool
 	HasBrightness       bool
+	MaxMirek            int // Warmest supported color temperature, if known.
 
 	LastUpdated time.Time
 	TargetState TargetState
+
+	// The last time timelight switched the light on or off, whose echo from the
+	// bridge is not a manual change.
+	power expectedPower
+}
+
+// expectedPower is an on/off state timelight sent, which the bridge reports
+// until at most the given time.
+type expectedPower struct {
+	on    bool
+	until time.Time
+}
+
+// litLight is a light which timelight turned on for a while, e.g. for an alarm.
+type litLight struct {
+	until     time.Time
+	wasActive bool // Whether timelight controlled the light before.
+}
+
+// expectsPower reports whether the bridge reporting the light as on or off at
+// eventTime is the echo of timelight switching it.
+func (l *Light) expectsPower(on bool, eventTime time.Time) bool {
+	return l.power.on == on && !eventTime.After(l.power.until)
 }
 
 func (l *Light) SetActive() {
@@ -38,6 +66,14 @@ func (l *Light) SetInactive() {
 	l.Active = false
 }
 
+// warmestMirek returns the warmest color temperature the light supports.
+func (l *Light) warmestMirek() int {
+	if l.MaxMirek > 0 && l.MaxMirek < MaxMirek {
+		return l.MaxMirek
+	}
+	return MaxMirek
+}
+
 func (l *Light) restrictTarget(target TargetState) TargetState {
 	if !l.HasBrightness {
 		target.HasBrightness = false
@@ -47,6 +83,10 @@ func (l *Light) restrictTarget(target TargetState) TargetState {
 		target.HasTempMirek = false
 		target.TempMirek = 0
 	}
+	if !l.HasColor {
+		target.HasColor = false
+		target.Color = hue.XY{}
+	}
 	return target
 }
 
@@ -58,35 +98,88 @@ func (l *Light) Update(now time.Time, target TargetState, duration time.Duration
 		return nil
 	}
 
+	if err := l.send(targetUpdate(target, duration)); err != nil {
+		return err
+	}
+
+	l.LastUpdated = now
+	l.TargetState = target
+
+	return nil
+}
+
+// TurnOn switches the light on at the target state. Whether timelight controls
+// the light is up to the caller.
+func (l *Light) TurnOn(now time.Time, target TargetState, duration time.Duration) error {
+	target = l.restrictTarget(target)
+
+	update := targetUpdate(target, duration)
+	update.On = &hue.LightOn{On: true}
+	if err := l.send(update); err != nil {
+		return err
+	}
+
+	l.On = true
+	l.power = expectedPower{on: true, until: now.Add(duration + lightUpdateGracePeriod)}
+	l.LastUpdated = now
+	l.TargetState = target
+
+	return nil
+}
+
+// TurnOff switches the light off. Whether timelight controls the light is up to
+// the caller.
+func (l *Light) TurnOff(now time.Time, duration time.Duration) error {
+	update := hue.LightUpdate{
+		On:       &hue.LightOn{On: false},
+		Dynamics: &hue.Dynamics{DurationMs: int(duration.Milliseconds())},
+	}
+	if err := l.send(update); err != nil {
+		return err
+	}
+
+	l.On = false
+	l.power = expectedPower{on: false, until: now.Add(duration + lightUpdateGracePeriod)}
+
+	return nil
+}
+
+func (l *Light) send(update hue.LightUpdate) error {
+	if l.dry != nil {
+		l.dry.updateLight(l.ID, update)
+		return nil
+	}
+	return l.h.UpdateLight(string(l.ID), update)
+}
+
+func targetUpdate(target TargetState, duration time.Duration) hue.LightUpdate {
 	var update hue.LightUpdate
 	if target.HasBrightness {
 		update.Dimming = &hue.DimmingUpdate{
 			Brightness: target.Brightness,
 		}
 	}
-	if target.HasTempMirek {
+	if target.HasColor {
+		update.Color = &hue.ColorUpdate{XY: target.Color}
+	} else if target.HasTempMirek {
 		update.ColorTemperature = &hue.ColorTemperatureUpdate{
 			Mirek: target.TempMirek,
 		}
 	}
 	update.Dynamics = &hue.Dynamics{DurationMs: int(duration.Milliseconds())}
-
-	if err := l.h.UpdateLight(string(l.ID), update); err != nil {
-		return err
-	}
-
-	l.LastUpdated = now
-	l.TargetState = target
-
-	return nil
+	return update
 }
 
 type TargetState struct {
-	HasBrightness bool
-	Brightness    float64 // 0 to 100
+	HasBrightness bool    `json:"has_brightness"`
+	Brightness    float64 `json:"brightness"` // 0 to 100
+
+	HasTempMirek bool `json:"has_temp_mirek"`
+	TempMirek    int  `json:"temp_mirek"` // 153 to 500
 
-	HasTempMirek bool
-	TempMirek    int // 153 to 500
+	// Color takes precedence over TempMirek on lights that support color.
+	HasColor bool   `json:"has_color"`
+	Color    hue.XY `json:"color"`
 }
 
 var DefaultTargetState = TargetState{}
@@ -100,10 +193,14 @@ func (s TargetState) LogValue() slog.Value {
 	if s.HasTempMirek {
 		tempMirek = fmt.Sprintf("%v", s.TempMirek)
 	}
-	return slog.GroupValue(
+	attrs := []slog.Attr{
 		slog.String("brightness", brightness),
 		slog.String("temp_mirek", tempMirek),
-	)
+	}
+	if s.HasColor {
+		attrs = append(attrs, slog.String("xy", fmt.Sprintf("[%v, %v]", s.Color.X, s.Color.Y)))
+	}
+	return slog.GroupValue(attrs...)
 }
 
 func (s TargetState) WithBrightness(brightness float64) TargetState {
@@ -118,6 +215,12 @@ func (s TargetState) WithColorTemp(mirek int) TargetState {
 	return s
 }
 
+func (s TargetState) WithColor(xy hue.XY) TargetState {
+	s.Color = xy
+	s.HasColor = true
+	return s
+}
+
 func (t *Timelight) initLights() error {
 	t.lights = make(map[LightID]*Light)
 
@@ -127,15 +230,7 @@ func (t *Timelight) initLights() error {
 	}
 
 	for _, l := range lights {
-		light := &Light{
-			h:      t.hue,
-			ID:     LightID(l.ID),
-			Active: false,
-
-			HasColor:            l.Color != nil,
-			HasColorTemperature: l.ColorTemperature != nil,
-			HasBrightness:       l.Dimming != nil,
-		}
+		light := t.newLight(l)
 		t.lights[light.ID] = light
 	}
 
@@ -144,30 +239,99 @@ func (t *Timelight) initLights() error {
 	return nil
 }
 
+func (t *Timelight) newLight(l hue.Light) *Light {
+	return &Light{
+		h:      t.hue,
+		dry:    t.dry,
+		ID:     LightID(l.ID),
+		Active: false,
+		On:     l.On != nil && l.On.On,
+
+		HasColor:            l.Color != nil,
+		HasColorTemperature: l.ColorTemperature != nil,
+		HasBrightness:       l.Dimming != nil,
+		MaxMirek:            maxMirek(l),
+	}
+}
+
+func maxMirek(l hue.Light) int {
+	if l.ColorTemperature == nil {
+		return 0
+	}
+	return l.ColorTemperature.MirekSchema.Max
+}
+
 func (t *Timelight) updateLights(now time.Time, target TargetState) {
 	t.log.Info("updating lights", slog.Any("target", target))
 
-	successes := 0
-	errs := 0
+	successes, errs := t.sendLightUpdates(now, target, 10*time.Second, nil)
+
+	t.log.Info("finished updating lights",
+		slog.Int("successes", successes),
+		slog.Int("errs", errs),
+	)
+}
+
+// sendLightUpdates updates the active lights for which include returns true, or
+// every active light if include is nil, and waits for the updates to finish.
+func (t *Timelight) sendLightUpdates(now time.Time, target TargetState, duration time.Duration, include func(*Light) bool) (successes, errs int) {
+	// Updates are issued concurrently; the hue client takes care of rate limiting.
+	var wg sync.WaitGroup
+	var succeeded, failed atomic.Int32
+	var mu sync.Mutex
+	var deleted []LightID
 
 	for _, light := range t.lights {
-		if !light.Active {
+		if !light.Active || (include != nil && !include(light)) {
 			continue
 		}
 
-		err := light.Update(now, target, 10*time.Second)
-		if err != nil {
-			t.log.Error("error while updating light",
-				slog.String("id", string(light.ID)),
-				slog.Any("err", err),
-			)
-			errs += 1
-		} else {
-			successes += 1
-		}
+		wg.Add(1)
+		go func(light *Light, target TargetState) {
+			defer wg.Done()
+
+			err := light.Update(now, target, duration)
+			if err != nil {
+				t.logUpdateError("error while updating light", string(light.ID), err)
+				if hue.IsNotFound(err) {
+					mu.Lock()
+					deleted = append(deleted, light.ID)
+					mu.Unlock()
+				}
+				failed.Add(1)
+			} else {
+				succeeded.Add(1)
+			}
+		}(light, t.lightTarget(light, now, target))
 	}
-	t.log.Info("finished updating lights",
-		slog.Int("successes", successes),
-		slog.Int("errs", errs),
-	)
+	wg.Wait()
+	successes, errs = int(succeeded.Load()), int(failed.Load())
+	t.metrics.updateResults(t.metrics.lightUpdates, successes, errs)
+
+	for _, id := range deleted {
+		t.removeLight(id)
+	}
+	return successes, errs
+}
+
+// lightTarget returns the target of a light, which differs from the schedule
+// while the light is ramping up for an alarm, lit by the night light, lit by
+// motion at night, or biased.
+func (t *Timelight) lightTarget(light *Light, now time.Time, target TargetState) TargetState {
+	if _, ok := t.wakeLights[light.ID]; ok {
+		return light.TargetState // Already ramping up to the target.
+	}
+	if _, ok := t.pathLights[light.ID]; ok && t.config.NightLight != nil {
+		return t.config.NightLight.target(light)
+	}
+	return t.biased(light, now, t.motionTarget(light.ID, now, target))
+}
+
+// removeLight stops tracking a light, e.g. because it was deleted from the bridge.
+func (t *Timelight) removeLight(id LightID) {
+	delete(t.lights, id)
+	for _, scene := range t.scenes {
+		scene.removeLight(id)
+	}
+	t.log.Info("removed light", slog.String("id", string(id)))
 }
@@ -0,0 +1,252 @@
+package timelight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lmittmann/tint"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	logFormatText   = "text"
+	logFormatLogfmt = "logfmt"
+	logFormatJSON   = "json"
+
+	defaultLogMaxSizeMB = 10
+	defaultLogMaxFiles  = 5
+
+	// componentKey is the attribute identifying the component a record is
+	// logged by.
+	componentKey  = "component"
+	componentHue  = "hue"
+	componentCore = "core"
+)
+
+// NewLogger creates a logger as configured. Records are filtered by the level of
+// the component they are logged by, which is set with
+// log.With(slog.String("component", ...)). The returned closer closes the log
+// file, if any.
+func (c LoggerConfig) NewLogger(stdout, stderr io.Writer) (*slog.Logger, io.Closer, error) {
+	levels := make(map[string]slog.Level)
+	for component, level := range map[string]string{
+		componentHue:  c.Levels.Hue,
+		componentCore: c.Levels.Core,
+	} {
+		l, err := c.componentLevel(level)
+		if err != nil {
+			return nil, nil, err
+		}
+		levels[component] = l
+	}
+	def, err := c.SlogLevel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The underlying handler accepts every level; filtering happens in
+	// componentHandler.
+	min := def
+	for _, l := range levels {
+		if l < min {
+			min = l
+		}
+	}
+
+	var w io.Writer
+	var closer io.Closer = nopCloser{}
+	switch c.Output {
+	case "", "stdout":
+		w = stdout
+	case "stderr":
+		w = stderr
+	default:
+		maxSize := c.MaxSizeMB
+		if maxSize == 0 {
+			maxSize = defaultLogMaxSizeMB
+		}
+		maxFiles := c.MaxFiles
+		if maxFiles == 0 {
+			maxFiles = defaultLogMaxFiles
+		}
+		f, err := openRotatingFile(c.Output, int64(maxSize)<<20, maxFiles)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closer = f, f
+	}
+
+	var base slog.Handler
+	switch c.Format {
+	case "", logFormatText:
+		base = tint.NewHandler(w, &tint.Options{
+			Level:      min,
+			TimeFormat: time.TimeOnly,
+			NoColor:    !isTerminal(w),
+		})
+	case logFormatLogfmt:
+		base = slog.NewTextHandler(w, &slog.HandlerOptions{Level: min})
+	case logFormatJSON:
+		base = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: min})
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("unknown log format %q", c.Format)
+	}
+
+	handler := &componentHandler{
+		base:   base,
+		levels: levels,
+		level:  def,
+	}
+	return slog.New(handler), closer, nil
+}
+
+func isStdStream(output string) bool {
+	return output == "" || output == "stdout" || output == "stderr"
+}
+
+// isTerminal reports whether w is a terminal, so that colors can be used.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// componentHandler filters records by the level of the component they were
+// logged by.
+type componentHandler struct {
+	base   slog.Handler
+	levels map[string]slog.Level
+	level  slog.Level // Level of the current component.
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.base.Enabled(ctx, level)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.base.Handle(ctx, r)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.base = h.base.WithAttrs(attrs)
+	for _, a := range attrs {
+		if a.Key != componentKey {
+			continue
+		}
+		if level, ok := h.levels[a.Value.String()]; ok {
+			h2.level = level
+		}
+	}
+	return &h2
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.base = h.base.WithGroup(name)
+	return &h2
+}
+
+// rotatingFile is a log file which is renamed to path.1 once it reaches maxSize
+// bytes, shifting older files up to path.<maxFiles>.
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(path); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		// If the file can't be rotated, keep writing to it rather than lose
+		// the record.
+		if err := r.rotate(); err != nil && r.f == nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate moves the file aside and starts a new one. If that fails, the file is
+// reopened wherever it ended up; r.f is only nil if that fails too.
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+	r.f = nil
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		// Missing files are expected until enough rotations have happened.
+		os.Rename(r.rotatedPath(i), r.rotatedPath(i+1))
+	}
+	current := r.path
+	err := os.Rename(r.path, r.rotatedPath(1))
+	if err == nil {
+		current = r.rotatedPath(1)
+		if err = r.open(r.path); err == nil {
+			return nil
+		}
+	}
+	if reopenErr := r.open(current); reopenErr != nil {
+		return errors.Join(err, reopenErr)
+	}
+	return err
+}
+
+func (r *rotatingFile) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
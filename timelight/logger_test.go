@@ -0,0 +1,99 @@
+package timelight
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerOutput(t *testing.T) {
+	tests := []struct {
+		output     string
+		wantStdout bool
+	}{
+		{"", true},
+		{"stdout", true},
+		{"stderr", false},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		log, closer, err := LoggerConfig{Output: tt.output}.NewLogger(&stdout, &stderr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Info("hello")
+		closer.Close()
+
+		got, other := stdout.String(), stderr.String()
+		if !tt.wantStdout {
+			got, other = other, got
+		}
+		if !strings.Contains(got, "hello") || other != "" {
+			t.Errorf("output %q: logged %q to the wrong stream", tt.output, got+other)
+		}
+		// Neither buffer is a terminal.
+		if strings.Contains(got, "\x1b[") {
+			t.Errorf("output %q: colored %q", tt.output, got)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timelight.log")
+	r, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for p, want := range map[string]string{
+		path:        "four\nfive\n",
+		path + ".1": "three\n",
+		path + ".2": "one\ntwo\n",
+	} {
+		if got := readFile(t, p); got != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than 2 old files kept: %v", err)
+	}
+}
+
+func TestRotatingFileKeepsWritingIfRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timelight.log")
+	r, err := openRotatingFile(path, 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// The log file can't be renamed over a directory which isn't empty.
+	if err := os.MkdirAll(filepath.Join(path+".1", "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"one\n", "two\n", "three\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := readFile(t, path), "one\ntwo\nthree\n"; got != want {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,278 @@
+package timelight
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aldld/hue/hue"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultSceneName = "Timelight"
+)
+
+var errRoomNotFound = errors.New("room not found")
+
+// CreatedScene describes a scene created by CreateScene.
+type CreatedScene struct {
+	ID     string
+	Name   string
+	Room   string
+	Lights int
+
+	// Selected reports whether the configured scene selection matches the new
+	// scene. If it does not, timelight will not keep it up to date.
+	Selected bool
+}
+
+// activeSpec returns the schedule of the active profile. Outside of Run, e.g.
+// when managing scenes from the command line, that is the profile saved in the
+// state file.
+func (t *Timelight) activeSpec() (Spec, error) {
+	if t.spec == nil {
+		if err := t.initSpec(time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return t.spec, nil
+}
+
+// CreateScene creates a scene in the named room containing all of the room's
+// lights, set to the current target state of the active profile. The scene is
+// marked with the configured app data, so that it is selected without relying
+// on its name.
+func (t *Timelight) CreateScene(roomName, sceneName string) (CreatedScene, error) {
+	var created CreatedScene
+
+	spec, err := t.activeSpec()
+	if err != nil {
+		return created, err
+	}
+	selector, err := t.config.Scenes.Selector()
+	if err != nil {
+		return created, err
+	}
+
+	room, err := t.findRoom(roomName)
+	if err != nil {
+		return created, err
+	}
+	lightIDs, err := t.roomLights(room)
+	if err != nil {
+		return created, err
+	}
+	if len(lightIDs) == 0 {
+		return created, fmt.Errorf("room %q has no lights", roomName)
+	}
+
+	lights, err := t.hue.GetLights()
+	if err != nil {
+		return created, err
+	}
+	lightsByID := make(map[string]hue.Light, len(lights))
+	for _, l := range lights {
+		lightsByID[l.ID] = l
+	}
+
+	target := spec.TargetLightState(time.Now())
+	actions := make([]hue.SceneAction, 0, len(lightIDs))
+	for _, id := range lightIDs {
+		l, ok := lightsByID[id]
+		if !ok {
+			continue
+		}
+		actions = append(actions, hue.SceneAction{
+			Target: hue.ResourceRef{ID: id, Type: hue.RTypeLight},
+			Action: sceneAction(t.newLight(l), target),
+		})
+	}
+
+	if sceneName == "" {
+		sceneName = defaultSceneName
+	}
+	appData := t.config.Scenes.AppData
+	if appData == "" {
+		appData = defaultSceneAppData
+	}
+
+	scene := hue.SceneCreate{
+		Metadata: hue.SceneMetadata{Name: sceneName, AppData: appData},
+		Group:    hue.ResourceRef{ID: room.ID, Type: hue.RTypeRoom},
+		Actions:  actions,
+	}
+	ref, err := t.hue.CreateScene(scene)
+	if err != nil {
+		return created, err
+	}
+
+	groups := map[string]string{room.ID: room.Metadata.Name}
+	selected, _ := selector.Match(hue.Scene{
+		ID:       ref.ID,
+		Metadata: scene.Metadata,
+		Group:    scene.Group,
+	}, groups)
+
+	t.log.Info("created scene",
+		slog.String("id", ref.ID),
+		slog.String("room", room.Metadata.Name),
+		slog.Any("target", target),
+	)
+
+	return CreatedScene{
+		ID:       ref.ID,
+		Name:     sceneName,
+		Room:     room.Metadata.Name,
+		Lights:   len(actions),
+		Selected: selected,
+	}, nil
+}
+
+func (t *Timelight) findRoom(name string) (hue.Room, error) {
+	rooms, err := hue.List[hue.Room](t.hue)
+	if err != nil {
+		return hue.Room{}, err
+	}
+	for _, r := range rooms {
+		if r.Metadata != nil && strings.EqualFold(r.Metadata.Name, name) {
+			return r, nil
+		}
+	}
+	return hue.Room{}, fmt.Errorf("%w: %s", errRoomNotFound, name)
+}
+
+// roomInfo describes a room, for the Home Assistant room switches and motion
+// triggers.
+type roomInfo struct {
+	ID      string
+	Name    string
+	Lights  []LightID // Tracked lights in the room.
+	Sensors []string  // Motion sensors in the room.
+}
+
+// loadRooms loads the rooms on the bridge, and the lights in each of them.
+func (t *Timelight) loadRooms() error {
+	rooms, err := hue.List[hue.Room](t.hue)
+	if err != nil {
+		return err
+	}
+	devices, err := t.devicesByID()
+	if err != nil {
+		return err
+	}
+
+	t.rooms = make(map[string]roomInfo, len(rooms))
+	for _, r := range rooms {
+		room := roomInfo{ID: r.ID, Name: r.ID}
+		if r.Metadata != nil {
+			room.Name = r.Metadata.Name
+		}
+		for _, id := range groupLights(r.Children, devices) {
+			if _, ok := t.lights[LightID(id)]; ok {
+				room.Lights = append(room.Lights, LightID(id))
+			}
+		}
+		room.Sensors = groupServices(r.Children, devices, hue.RTypeMotion)
+		t.rooms[r.ID] = room
+	}
+	return nil
+}
+
+// roomLights returns the IDs of the lights belonging to the devices in a room.
+func (t *Timelight) roomLights(room hue.Room) ([]string, error) {
+	devices, err := t.devicesByID()
+	if err != nil {
+		return nil, err
+	}
+	return groupLights(room.Children, devices), nil
+}
+
+func (t *Timelight) devicesByID() (map[string]hue.Device, error) {
+	devices, err := hue.List[hue.Device](t.hue)
+	if err != nil {
+		return nil, err
+	}
+	devicesByID := make(map[string]hue.Device, len(devices))
+	for _, d := range devices {
+		devicesByID[d.ID] = d
+	}
+	return devicesByID, nil
+}
+
+// groupLights returns the IDs of the lights among a group's children, including
+// the lights of child devices.
+func groupLights(children []hue.ResourceRef, devicesByID map[string]hue.Device) []string {
+	return groupServices(children, devicesByID, hue.RTypeLight)
+}
+
+// groupServices returns the IDs of the resources of the given type among a
+// group's children, including the services of child devices.
+func groupServices(children []hue.ResourceRef, devicesByID map[string]hue.Device, rtype hue.ResourceType) []string {
+	var ids []string
+	for _, child := range children {
+		switch child.Type {
+		case rtype:
+			ids = append(ids, child.ID)
+		case hue.RTypeDevice:
+			for _, service := range devicesByID[child.ID].Services {
+				if service.Type == rtype {
+					ids = append(ids, service.ID)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// DeleteScene deletes a timelight scene, given its ID or name. Scenes that are
+// not selected by the configured criteria are never deleted.
+func (t *Timelight) DeleteScene(idOrName string) (SceneMatch, error) {
+	matches, err := t.MatchScenes()
+	if err != nil {
+		return SceneMatch{}, err
+	}
+
+	var found []SceneMatch
+	for _, m := range matches {
+		if m.ID == idOrName || strings.EqualFold(m.Name, idOrName) {
+			found = append(found, m)
+		}
+	}
+	switch {
+	case len(found) == 0:
+		return SceneMatch{}, fmt.Errorf("scene not found: %s", idOrName)
+	case len(found) > 1:
+		return SceneMatch{}, fmt.Errorf("%d scenes are named %q; delete by ID instead", len(found), idOrName)
+	case !found[0].Matched:
+		return found[0], fmt.Errorf("scene %q is not a timelight scene", found[0].Name)
+	}
+
+	if err := t.hue.DeleteScene(found[0].ID); err != nil {
+		return found[0], err
+	}
+	t.log.Info("deleted scene", slog.String("id", found[0].ID))
+
+	return found[0], nil
+}
+
+// SyncScenes updates every timelight scene to the current target state of the
+// active profile once.
+func (t *Timelight) SyncScenes() error {
+	if err := t.initLights(); err != nil {
+		return err
+	}
+	if err := t.initScenes(); err != nil {
+		return err
+	}
+	spec, err := t.activeSpec()
+	if err != nil {
+		return err
+	}
+
+	if errs := t.updateScenes(spec.TargetLightState(time.Now())); errs != 0 {
+		return fmt.Errorf("%d scenes could not be updated", errs)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package timelight
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aldld/hue/hue"
+)
+
+func TestSceneSelectorMatch(t *testing.T) {
+	groups := map[string]string{"r1": "Living Room", "z1": "Upstairs"}
+	scene := func(id, name, appData string, group hue.ResourceRef) hue.Scene {
+		return hue.Scene{ID: id, Metadata: hue.SceneMetadata{Name: name, AppData: appData}, Group: group}
+	}
+	room := hue.ResourceRef{ID: "r1", Type: hue.RTypeRoom}
+	zone := hue.ResourceRef{ID: "z1", Type: hue.RTypeZone}
+
+	tests := []struct {
+		name   string
+		config SceneConfig
+		scene  hue.Scene
+		want   bool
+	}{
+		{"default app data", SceneConfig{}, scene("s1", "Evening", "timelight", room), true},
+		{"default name", SceneConfig{}, scene("s1", "My TimeLight", "", room), true},
+		{"default, other scene", SceneConfig{}, scene("s1", "Evening", "", room), false},
+		{"id", SceneConfig{IDs: []string{"s1"}}, scene("s1", "Evening", "", room), true},
+		{"id is case-sensitive", SceneConfig{IDs: []string{"S1"}}, scene("s1", "Evening", "", room), false},
+		{"room, case-insensitively", SceneConfig{Rooms: []string{"living room"}}, scene("s1", "Evening", "", room), true},
+		{"room is not a zone", SceneConfig{Zones: []string{"Living Room"}}, scene("s1", "Evening", "", room), false},
+		{"zone", SceneConfig{Zones: []string{"upstairs"}}, scene("s1", "Evening", "", zone), true},
+		{"unknown group", SceneConfig{Rooms: []string{"Kitchen"}}, scene("s1", "Evening", "", hue.ResourceRef{ID: "r2", Type: hue.RTypeRoom}), false},
+		{"app data", SceneConfig{AppData: "mine"}, scene("s1", "Evening", "mine", room), true},
+		{"configured criteria replace the defaults", SceneConfig{AppData: "mine"}, scene("s1", "Timelight", "timelight", room), false},
+		{"name pattern", SceneConfig{NamePatterns: []string{"^Auto "}}, scene("s1", "Auto evening", "", room), true},
+		{"any criterion", SceneConfig{IDs: []string{"s9"}, NamePatterns: []string{"^Auto "}}, scene("s1", "Auto evening", "", room), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.config.Selector()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, reason := s.Match(tt.scene, groups); got != tt.want {
+				t.Errorf("Match() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+
+	if _, err := (SceneConfig{NamePatterns: []string{"("}}).Selector(); err == nil {
+		t.Error("invalid name pattern accepted")
+	}
+}
+
+// sceneBridge serves lights and scenes, and records scene updates.
+type sceneBridge struct {
+	*httptest.Server
+	resources map[string]string // JSON arrays, keyed by resource type.
+
+	mu      sync.Mutex
+	updates map[string]hue.SceneUpdate // Keyed by scene ID.
+}
+
+func newSceneBridge(t *testing.T, resources map[string]string) *sceneBridge {
+	b := &sceneBridge{resources: resources, updates: make(map[string]hue.SceneUpdate)}
+	b.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/clip/v2/resource/")
+		if r.Method == http.MethodPut {
+			var update hue.SceneUpdate
+			body, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(body, &update); err != nil {
+				t.Errorf("invalid update of %s: %v", path, err)
+			}
+			b.mu.Lock()
+			b.updates[strings.TrimPrefix(path, "scene/")] = update
+			b.mu.Unlock()
+			w.Write([]byte(`{"data": [], "errors": []}`))
+			return
+		}
+		data, ok := b.resources[path]
+		if !ok {
+			data = "[]"
+		}
+		w.Write([]byte(`{"data": ` + data + `, "errors": []}`))
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+func TestSyncScenesUsesActiveProfile(t *testing.T) {
+	bridge := newSceneBridge(t, map[string]string{
+		"light": `[{"id": "l1", "type": "light", "on": {"on": true}, "dimming": {"brightness": 50},
+			"color_temperature": {"mirek": 300, "mirek_valid": true, "mirek_schema": {"mirek_minimum": 153, "mirek_maximum": 500}}},
+			{"id": "l2", "type": "light", "on": {"on": false}}]`,
+		"scene": `[{"id": "s1", "type": "scene", "metadata": {"name": "Timelight"}, "group": {"rid": "r1", "rtype": "room"},
+			"actions": [
+				{"target": {"rid": "l1", "rtype": "light"}, "action": {"on": {"on": true}, "dimming": {"brightness": 80}}},
+				{"target": {"rid": "l2", "rtype": "light"}, "action": {"on": {"on": true}}},
+				{"target": {"rid": "l9", "rtype": "light"}, "action": {"on": {"on": false}}}]},
+			{"id": "s2", "type": "scene", "metadata": {"name": "Reading"}, "group": {"rid": "r1", "rtype": "room"}, "actions": []}]`,
+	})
+
+	night := TransitionConfig{StartTime: "07:00", TransitionTime: "18:00", EndTime: "22:00"}
+	brightness, temp := night, night
+	brightness.StartValue, brightness.EndValue = 10, 10
+	temp.StartValue, temp.EndValue = 454, 454
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	data, _ := json.Marshal(checkpoint{Time: time.Now(), Profile: "night"})
+	if err := os.WriteFile(stateFile, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{
+		Bridge:    BridgeConfig{Addr: bridge.Listener.Addr().String(), Username: "key"},
+		Timelight: testSchedule,
+		Profiles:  map[string]TimelightConfig{"night": {Brightness: brightness, ColorTemp: temp}},
+		Shutdown:  ShutdownConfig{StateFile: stateFile},
+	}
+	// As in the scenes command: the schedule isn't loaded, and updates are sent.
+	tl := newTestTimelight(config)
+	tl.spec, tl.dry = nil, nil
+
+	if err := tl.SyncScenes(); err != nil {
+		t.Fatal(err)
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	if _, ok := bridge.updates["s2"]; ok || len(bridge.updates) != 1 {
+		t.Fatalf("updated scenes %v, want only s1", bridge.updates)
+	}
+	update := bridge.updates["s1"]
+	if update.Actions == nil {
+		t.Fatal("s1 updated without actions")
+	}
+	on := &hue.LightOn{On: true}
+	want := []hue.SceneAction{
+		{Target: hue.ResourceRef{ID: "l1", Type: hue.RTypeLight}, Action: hue.Action{
+			On:               on,
+			Dimming:          &hue.DimmingAction{Brightness: 10},
+			ColorTemperature: &hue.ColorTemperatureAction{Mirek: 454},
+		}},
+		{Target: hue.ResourceRef{ID: "l2", Type: hue.RTypeLight}, Action: hue.Action{On: on}},
+		{Target: hue.ResourceRef{ID: "l9", Type: hue.RTypeLight}, Action: hue.Action{On: &hue.LightOn{On: false}}},
+	}
+	if got := *update.Actions; !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("actions = %s, want %s", gotJSON, wantJSON)
+	}
+}
@@ -0,0 +1,287 @@
+package timelight
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldld/hue/hue"
+)
+
+// requestDurationBuckets are the upper bounds of the request latency histogram,
+// in seconds.
+var requestDurationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics collects counters for the Prometheus text exposition format. Gauges
+// describing the current state are read from the main loop when scraped.
+type metrics struct {
+	mu sync.Mutex
+
+	requests         map[[3]string]float64 // method, endpoint, status
+	requestErrors    map[[2]string]float64 // method, endpoint
+	requestDurations map[[2]string]*histogram
+
+	connects    float64
+	disconnects float64
+	events      map[string]float64 // Event type.
+
+	overrides    float64
+	lightUpdates map[string]float64 // Result.
+	sceneUpdates map[string]float64 // Result.
+}
+
+type histogram struct {
+	counts []float64 // Cumulative count for each bucket.
+	sum    float64
+	count  float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:         make(map[[3]string]float64),
+		requestErrors:    make(map[[2]string]float64),
+		requestDurations: make(map[[2]string]*histogram),
+		events:           make(map[string]float64),
+		lightUpdates:     make(map[string]float64),
+		sceneUpdates:     make(map[string]float64),
+	}
+}
+
+// hooks returns hooks which record the hue client's activity.
+func (m *metrics) hooks() hue.Hooks {
+	return hue.Hooks{
+		Request:    m.observeRequest,
+		Connect:    func() { m.add(&m.connects, 1) },
+		Disconnect: func(error) { m.add(&m.disconnects, 1) },
+		Event: func(event hue.Event) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.events[event.Type]++
+		},
+	}
+}
+
+func (m *metrics) observeRequest(info hue.RequestInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := "none"
+	if info.Status != 0 {
+		status = strconv.Itoa(info.Status)
+	}
+	m.requests[[3]string{info.Method, info.Endpoint, status}]++
+	if info.Err != nil {
+		m.requestErrors[[2]string{info.Method, info.Endpoint}]++
+	}
+
+	key := [2]string{info.Method, info.Endpoint}
+	h, ok := m.requestDurations[key]
+	if !ok {
+		h = &histogram{counts: make([]float64, len(requestDurationBuckets))}
+		m.requestDurations[key] = h
+	}
+	seconds := info.Duration.Seconds()
+	for i, bound := range requestDurationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (m *metrics) add(counter *float64, n float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	*counter += n
+}
+
+func (m *metrics) override() {
+	m.add(&m.overrides, 1)
+}
+
+func (m *metrics) updateResults(results map[string]float64, successes, errs int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	results["success"] += float64(successes)
+	results["error"] += float64(errs)
+}
+
+// stateMetrics are gauges describing timelight's current state.
+type stateMetrics struct {
+	activeLights   int
+	inactiveLights int
+	scenes         int
+	target         TargetState
+	paused         bool
+}
+
+func (t *Timelight) stateMetrics(now time.Time) stateMetrics {
+	s := stateMetrics{
+		scenes: len(t.scenes),
+		target: t.spec.TargetLightState(now),
+		paused: t.isPaused(now),
+	}
+	for _, l := range t.lights {
+		if l.Active {
+			s.activeLights++
+		} else {
+			s.inactiveLights++
+		}
+	}
+	return s
+}
+
+func (t *Timelight) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var state stateMetrics
+	err := t.do(r.Context(), func(t *Timelight) error {
+		state = t.stateMetrics(time.Now())
+		return nil
+	})
+	if err != nil {
+		t.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	t.metrics.write(w, state)
+}
+
+func (m *metrics) write(w io.Writer, state stateMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := promWriter{w: w}
+
+	p.header("timelight_hue_requests_total", "counter", "Requests to the bridge, by endpoint and status.")
+	for _, k := range sortedKeys(m.requests) {
+		p.sample("timelight_hue_requests_total", m.requests[k],
+			"method", k[0], "endpoint", k[1], "status", k[2])
+	}
+
+	p.header("timelight_hue_request_errors_total", "counter", "Failed requests to the bridge, by endpoint.")
+	for _, k := range sortedKeys(m.requestErrors) {
+		p.sample("timelight_hue_request_errors_total", m.requestErrors[k],
+			"method", k[0], "endpoint", k[1])
+	}
+
+	p.header("timelight_hue_request_duration_seconds", "histogram", "Latency of requests to the bridge.")
+	for _, k := range sortedKeys(m.requestDurations) {
+		h := m.requestDurations[k]
+		for i, bound := range requestDurationBuckets {
+			p.sample("timelight_hue_request_duration_seconds_bucket", h.counts[i],
+				"method", k[0], "endpoint", k[1], "le", formatFloat(bound))
+		}
+		p.sample("timelight_hue_request_duration_seconds_bucket", h.count,
+			"method", k[0], "endpoint", k[1], "le", "+Inf")
+		p.sample("timelight_hue_request_duration_seconds_sum", h.sum, "method", k[0], "endpoint", k[1])
+		p.sample("timelight_hue_request_duration_seconds_count", h.count, "method", k[0], "endpoint", k[1])
+	}
+
+	p.header("timelight_eventstream_connects_total", "counter", "Connections to the bridge's event stream.")
+	p.sample("timelight_eventstream_connects_total", m.connects)
+	p.header("timelight_eventstream_disconnects_total", "counter", "Interruptions of the bridge's event stream.")
+	p.sample("timelight_eventstream_disconnects_total", m.disconnects)
+
+	p.header("timelight_events_total", "counter", "Events received from the bridge, by type.")
+	for _, k := range sortedKeys(m.events) {
+		p.sample("timelight_events_total", m.events[k], "type", k)
+	}
+
+	p.header("timelight_overrides_total", "counter", "Manual light changes detected.")
+	p.sample("timelight_overrides_total", m.overrides)
+
+	p.header("timelight_light_updates_total", "counter", "Light updates, by result.")
+	for _, k := range sortedKeys(m.lightUpdates) {
+		p.sample("timelight_light_updates_total", m.lightUpdates[k], "result", k)
+	}
+	p.header("timelight_scene_updates_total", "counter", "Scene updates, by result.")
+	for _, k := range sortedKeys(m.sceneUpdates) {
+		p.sample("timelight_scene_updates_total", m.sceneUpdates[k], "result", k)
+	}
+
+	p.header("timelight_lights", "gauge", "Tracked lights, by whether timelight controls them.")
+	p.sample("timelight_lights", float64(state.activeLights), "state", "active")
+	p.sample("timelight_lights", float64(state.inactiveLights), "state", "inactive")
+
+	p.header("timelight_scenes", "gauge", "Timelight scenes.")
+	p.sample("timelight_scenes", float64(state.scenes))
+
+	p.header("timelight_paused", "gauge", "Whether updates are paused.")
+	p.sample("timelight_paused", boolFloat(state.paused))
+
+	if state.target.HasBrightness {
+		p.header("timelight_target_brightness", "gauge", "Current target brightness, in percent.")
+		p.sample("timelight_target_brightness", state.target.Brightness)
+	}
+	if state.target.HasTempMirek {
+		p.header("timelight_target_mirek", "gauge", "Current target color temperature, in mirek.")
+		p.sample("timelight_target_mirek", float64(state.target.TempMirek))
+	}
+}
+
+// promWriter writes metrics in the Prometheus text exposition format.
+type promWriter struct {
+	w io.Writer
+}
+
+func (p promWriter) header(name, typ, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a single sample; labels are given as name, value pairs.
+func (p promWriter) sample(name string, value float64, labels ...string) {
+	if len(labels) == 0 {
+		fmt.Fprintf(p.w, "%s %s\n", name, formatFloat(value))
+		return
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	fmt.Fprintf(p.w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+}
+
+// labelEscaper escapes label values as the text format expects: only
+// backslashes, double quotes and newlines are escaped.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type metricKey interface {
+	string | [2]string | [3]string
+}
+
+func sortedKeys[K metricKey, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
@@ -0,0 +1,29 @@
+package timelight
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPromWriterSample(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []string
+		want   string
+	}{
+		{"no labels", nil, "m 1\n"},
+		{"plain", []string{"room", "Living room"}, `m{room="Living room"} 1` + "\n"},
+		{"escaped", []string{"room", "a\\b \"c\"\nd"}, `m{room="a\\b \"c\"\nd"} 1` + "\n"},
+		{"unicode", []string{"room", "Küche\t"}, "m{room=\"Küche\t\"} 1\n"},
+		{"several", []string{"a", "1", "b", "2"}, `m{a="1",b="2"} 1` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			promWriter{&b}.sample("m", 1, tt.labels...)
+			if got := b.String(); got != tt.want {
+				t.Errorf("sample() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package timelight
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aldld/hue/hue"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultMotionTimeout = 5 * time.Minute
+
+	motionOnTransition  = 500 * time.Millisecond
+	motionOffTransition = 10 * time.Second
+)
+
+// MotionConfig turns on the lights in some rooms when motion is detected, and
+// turns them off again once no motion has been detected for a while.
+type MotionConfig struct {
+	Rooms []string `toml:"rooms"` // Names of rooms, matched case-insensitively.
+
+	// Sensors are the IDs or device names of the motion sensors which trigger
+	// the rooms. If empty, every motion sensor in the rooms is used.
+	Sensors []string `toml:"sensors"`
+
+	// Timeout is how long after the last motion lights are turned off, e.g. "5m".
+	Timeout string `toml:"timeout"`
+
+	// Night, if set, changes how motion is handled during part of the day.
+	Night *MotionNightConfig `toml:"night"`
+}
+
+// MotionNightConfig overrides motion handling between StartTime and EndTime,
+// which may span midnight.
+type MotionNightConfig struct {
+	StartTime string `toml:"start_time"`
+	EndTime   string `toml:"end_time"`
+
+	// Disabled ignores motion at night.
+	Disabled bool `toml:"disabled"`
+
+	// Timeout replaces the daytime timeout at night.
+	Timeout string `toml:"timeout"`
+
+	// Brightness and ColorTempMirek replace the schedule's target at night.
+	Brightness     *float64 `toml:"brightness"`
+	ColorTempMirek *int     `toml:"color_temp_mirek"`
+}
+
+func (c MotionConfig) timeout() time.Duration {
+	return parsePositiveDuration(c.Timeout, defaultMotionTimeout)
+}
+
+func parsePositiveDuration(s string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// contains reports whether now falls within the night window.
+func (c MotionNightConfig) contains(now time.Time) bool {
+	return inWindow(now, c.StartTime, c.EndTime)
+}
+
+// inWindow reports whether now falls between the start and end times of day,
+// which may span midnight.
+func inWindow(now time.Time, startTime, endTime string) bool {
+	start, err := parseMinuteOfDay(startTime)
+	if err != nil {
+		return false
+	}
+	end, err := parseMinuteOfDay(endTime)
+	if err != nil {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return start <= minute && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// target replaces the parts of the schedule's target that are configured for
+// the night.
+func (c MotionNightConfig) target(scheduled TargetState) TargetState {
+	night := StateConfig{Brightness: c.Brightness, ColorTempMirek: c.ColorTempMirek}.TargetState()
+	if night.HasBrightness {
+		scheduled = scheduled.WithBrightness(night.Brightness)
+	}
+	if night.HasTempMirek {
+		scheduled = scheduled.WithColorTemp(night.TempMirek)
+	}
+	return scheduled
+}
+
+func (c MotionConfig) validate(ps *Problems, key string) {
+	if len(c.Rooms) == 0 {
+		ps.errorf(key+".rooms", "at least one room is required")
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			ps.errorf(key+".timeout", "invalid duration %q", c.Timeout)
+		}
+	}
+	if n := c.Night; n != nil {
+		if _, err := parseMinuteOfDay(n.StartTime); err != nil {
+			ps.errorf(key+".night.start_time", "%v", err)
+		}
+		if _, err := parseMinuteOfDay(n.EndTime); err != nil {
+			ps.errorf(key+".night.end_time", "%v", err)
+		}
+		if n.Timeout != "" {
+			if d, err := time.ParseDuration(n.Timeout); err != nil || d <= 0 {
+				ps.errorf(key+".night.timeout", "invalid duration %q", n.Timeout)
+			}
+		}
+		StateConfig{Brightness: n.Brightness, ColorTempMirek: n.ColorTempMirek}.validate(ps, key+".night")
+	}
+}
+
+// motionZone is a set of lights controlled by a set of motion sensors.
+type motionZone struct {
+	config  MotionConfig
+	sensors map[string]bool // IDs of motion resources.
+	lights  []LightID
+
+	lastMotion time.Time
+	timeout    time.Duration    // Timeout in effect when motion was last detected.
+	lit        map[LightID]bool // Lights turned on by motion, and whether they were active before.
+}
+
+// loadMotion resolves the configured motion triggers to sensors and lights.
+// Rooms must already be loaded. Lights that were turned on by motion stay
+// scheduled to turn off if they are still covered by the new triggers.
+func (t *Timelight) loadMotion() error {
+	var names map[string]string // Device names of motion sensors, keyed by ID.
+	for _, c := range t.config.Motion {
+		if len(c.Sensors) > 0 {
+			var err error
+			if names, err = t.motionSensorNames(); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	old := t.motion
+	t.motion = nil
+	for _, c := range t.config.Motion {
+		z := &motionZone{
+			config:  c,
+			sensors: make(map[string]bool),
+			timeout: c.timeout(),
+			lit:     make(map[LightID]bool),
+		}
+		for _, name := range c.Rooms {
+			room, ok := t.roomByName(name)
+			if !ok {
+				t.log.Warn("room for motion trigger not found", slog.String("room", name))
+				continue
+			}
+			z.lights = append(z.lights, room.Lights...)
+			if len(c.Sensors) == 0 {
+				for _, id := range room.Sensors {
+					z.sensors[id] = true
+				}
+			}
+		}
+		for _, s := range c.Sensors {
+			found := false
+			for id, name := range names {
+				if id == s || strings.EqualFold(name, s) {
+					z.sensors[id] = true
+					found = true
+				}
+			}
+			if !found {
+				t.log.Warn("motion sensor not found", slog.String("sensor", s))
+			}
+		}
+		if len(z.sensors) == 0 {
+			t.log.Warn("no motion sensors found for rooms", slog.Any("rooms", c.Rooms))
+		}
+		t.motion = append(t.motion, z)
+	}
+
+	for _, o := range old {
+		for id, wasActive := range o.lit {
+			if z := t.motionZoneOf(id); z != nil {
+				z.lit[id] = wasActive
+				if o.lastMotion.After(z.lastMotion) {
+					z.lastMotion, z.timeout = o.lastMotion, o.timeout
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Timelight) motionSensorNames() (map[string]string, error) {
+	sensors, err := hue.List[hue.Motion](t.hue)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := t.devicesByID()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(sensors))
+	for _, s := range sensors {
+		names[s.ID] = s.ID
+		if s.Owner != nil {
+			if d, ok := devices[s.Owner.ID]; ok && d.Metadata != nil {
+				names[s.ID] = d.Metadata.Name
+			}
+		}
+	}
+	return names, nil
+}
+
+func (t *Timelight) roomByName(name string) (roomInfo, bool) {
+	for _, room := range t.rooms {
+		if strings.EqualFold(room.Name, name) {
+			return room, true
+		}
+	}
+	return roomInfo{}, false
+}
+
+// motionZoneOf returns the first zone containing a light, or nil.
+func (t *Timelight) motionZoneOf(id LightID) *motionZone {
+	for _, z := range t.motion {
+		for _, l := range z.lights {
+			if l == id {
+				return z
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Timelight) handleMotion(motion hue.Motion, eventTime time.Time) {
+	if motion.Motion == nil || !motion.Motion.MotionValid || !motion.Motion.Motion {
+		return
+	}
+	for _, z := range t.motion {
+		if z.sensors[motion.ID] {
+			t.motionDetected(z, eventTime)
+		}
+	}
+}
+
+// motionDetected turns on the zone's lights which are off at the current target.
+// Lights that are already on are left alone unless motion turned them on and
+// they haven't been changed manually since, so manual changes are respected.
+func (t *Timelight) motionDetected(z *motionZone, now time.Time) {
+	if t.isPaused(now) {
+		t.log.Debug("paused, ignoring motion")
+		return
+	}
+
+	target := t.spec.TargetLightState(now)
+	timeout := z.config.timeout()
+	if night := z.config.Night; night != nil && night.contains(now) {
+		if night.Disabled {
+			t.log.Debug("ignoring motion at night", slog.Any("rooms", z.config.Rooms))
+			return
+		}
+		target = night.target(target)
+		timeout = parsePositiveDuration(night.Timeout, timeout)
+	} else if night == nil && t.nightLightActive(now) {
+		t.lightPath(now, z.lights)
+		return
+	}
+
+	z.lastMotion = now
+	z.timeout = timeout
+
+	var turnedOn int
+	for _, id := range z.lights {
+		light, ok := t.lights[id]
+		if !ok {
+			continue
+		}
+		_, lit := z.lit[id]
+
+		var err error
+		switch {
+		case !light.On:
+			err = light.TurnOn(now, target, motionOnTransition)
+			if err == nil {
+				if !lit {
+					z.lit[id] = light.Active
+				}
+				light.SetActive()
+				turnedOn++
+			}
+		case lit && light.Active:
+			// Night and day targets may differ.
+			err = light.Update(now, target, motionOnTransition)
+		}
+		if err != nil {
+			t.logUpdateError("error while turning on light", string(id), err)
+		}
+	}
+
+	if turnedOn > 0 {
+		t.log.Info("motion detected, turned on lights",
+			slog.Any("rooms", z.config.Rooms),
+			slog.Int("lights", turnedOn),
+			slog.Any("target", target),
+			slog.Duration("timeout", timeout),
+		)
+	}
+}
+
+// checkMotionTimeouts turns off the lights that motion turned on, once no motion
+// has been detected for the timeout, and restores whether timelight controls
+// them. Lights which were changed manually since are left on.
+func (t *Timelight) checkMotionTimeouts(now time.Time) {
+	for _, z := range t.motion {
+		if len(z.lit) == 0 || now.Sub(z.lastMotion) < z.timeout {
+			continue
+		}
+
+		var turnedOff int
+		for id, wasActive := range z.lit {
+			delete(z.lit, id)
+			light, ok := t.lights[id]
+			if !ok || !light.On || !light.Active {
+				continue
+			}
+			if err := light.TurnOff(now, motionOffTransition); err != nil {
+				t.logUpdateError("error while turning off light", string(id), err)
+				continue
+			}
+			light.Active = wasActive
+			turnedOff++
+		}
+
+		t.log.Info("no motion, turned off lights",
+			slog.Any("rooms", z.config.Rooms),
+			slog.Duration("timeout", z.timeout),
+			slog.Int("lights", turnedOff),
+		)
+	}
+}
+
+// motionTarget returns the target of a light, which differs from the schedule
+// at night if motion turned the light on.
+func (t *Timelight) motionTarget(id LightID, now time.Time, target TargetState) TargetState {
+	for _, z := range t.motion {
+		if _, lit := z.lit[id]; lit && z.config.Night != nil && z.config.Night.contains(now) {
+			return z.config.Night.target(target)
+		}
+	}
+	return target
+}
@@ -0,0 +1,87 @@
+package timelight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aldld/hue/hue"
+)
+
+func TestMotionTurnsLightsOnAndOff(t *testing.T) {
+	tl := newTestTimelight(Config{}, "active", "inactive", "overridden")
+	// The inactive light is off, e.g. since startup or a manual change, and the
+	// overridden light was changed manually while on.
+	tl.lights["inactive"].SetInactive()
+	tl.lights["overridden"].SetInactive()
+	tl.lights["overridden"].On = true
+	z := &motionZone{
+		config:  MotionConfig{Rooms: []string{"Hall"}},
+		lights:  []LightID{"active", "inactive", "overridden"},
+		lit:     make(map[LightID]bool),
+		timeout: defaultMotionTimeout,
+	}
+	tl.motion = []*motionZone{z}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	active, inactive, overridden := tl.lights["active"], tl.lights["inactive"], tl.lights["overridden"]
+
+	tl.motionDetected(z, now)
+	tl.handleLightUpdate(powerUpdate("active", true), now.Add(time.Second))
+	tl.handleLightUpdate(powerUpdate("inactive", true), now.Add(time.Second))
+	for _, l := range []*Light{active, inactive} {
+		if !l.On || !l.Active {
+			t.Errorf("light %s: on %v, active %v; want on and active", l.ID, l.On, l.Active)
+		}
+	}
+	if !overridden.On || overridden.Active || overridden.TargetState != (TargetState{}) {
+		t.Errorf("overridden light: on %v, active %v, target %+v; want it left alone",
+			overridden.On, overridden.Active, overridden.TargetState)
+	}
+
+	// Once motion times out, the lights are turned off, and the bridge reports
+	// them off once they have faded out.
+	off := now.Add(z.timeout)
+	tl.checkMotionTimeouts(off)
+	tl.handleLightUpdate(powerUpdate("active", false), off.Add(motionOffTransition))
+	tl.handleLightUpdate(powerUpdate("inactive", false), off.Add(motionOffTransition))
+	if active.On || !active.Active {
+		t.Errorf("active light after timeout: on %v, active %v; want off and active", active.On, active.Active)
+	}
+	if inactive.On || inactive.Active {
+		t.Errorf("inactive light after timeout: on %v, active %v; want off and inactive again", inactive.On, inactive.Active)
+	}
+
+	// Motion turns them on again.
+	tl.motionDetected(z, now.Add(time.Hour))
+	if !active.On || !inactive.On {
+		t.Errorf("after more motion: active light on %v, inactive light on %v; want both on", active.On, inactive.On)
+	}
+}
+
+func TestMotionRespectsManualChanges(t *testing.T) {
+	tl := newTestTimelight(Config{}, "l1")
+	light := tl.lights["l1"]
+	z := &motionZone{lights: []LightID{"l1"}, lit: make(map[LightID]bool), timeout: defaultMotionTimeout}
+	tl.motion = []*motionZone{z}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// The light is dimmed manually after motion turned it on.
+	tl.motionDetected(z, now)
+	dimmed := hue.Light{ID: "l1", Dimming: &hue.Dimming{Brightness: 10}}
+	tl.handleLightUpdate(dimmed, now.Add(time.Minute))
+	if !light.On || light.Active {
+		t.Fatalf("on %v, active %v; want the manual change to take over", light.On, light.Active)
+	}
+	tl.motionDetected(z, now.Add(2*time.Minute))
+	tl.checkMotionTimeouts(now.Add(time.Hour))
+	if !light.On || light.Active || light.TargetState != testTarget {
+		t.Errorf("on %v, active %v, target %+v; want the manually changed light left alone",
+			light.On, light.Active, light.TargetState)
+	}
+
+	// Switching it off by hand isn't mistaken for timelight's own change.
+	light.SetActive()
+	tl.handleLightUpdate(powerUpdate("l1", false), now.Add(2*time.Hour))
+	if light.On || light.Active {
+		t.Errorf("on %v, active %v; want a manual switch off to take over", light.On, light.Active)
+	}
+}
@@ -0,0 +1,371 @@
+package timelight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultMQTTTopicPrefix = "timelight"
+	defaultMQTTClientID    = "timelight"
+
+	mqttConnectTimeout    = 10 * time.Second
+	mqttCommandTimeout    = 30 * time.Second
+	mqttDisconnectQuiesce = 250 // Milliseconds.
+)
+
+// Timelight publishes its state to these topics, relative to the topic prefix.
+// Every topic except override is retained.
+//
+//	status          "online" or "offline".
+//	bridge          "online" while connected to the bridge's event stream.
+//	target          Current target state, profile and pause state, as in /api/target.
+//	lights/{id}     State of each light, as in /api/lights.
+//	override        A light was changed by something other than timelight.
+//
+// Commands are received on cmd/{command}, with the argument as the payload:
+//
+//	cmd/activate_room     Room name.
+//	cmd/deactivate_room   Room name.
+//	cmd/activate_light    Light ID.
+//	cmd/deactivate_light  Light ID.
+//	cmd/pause             Optional duration, e.g. "1h".
+//	cmd/resume
+//	cmd/update
+//	cmd/profile           Profile name.
+//	cmd/skip_alarm        Alarm name, or empty to skip every alarm's next ring.
+//
+// With Home Assistant discovery enabled, the following topics are also used:
+//
+//	rooms/{id}/active     "ON" if timelight controls every light in the room.
+//	rooms/{id}/set        "ON" or "OFF" to activate or deactivate the room.
+
+// mqttClient is the subset of an MQTT client used by timelight.
+type mqttClient interface {
+	Publish(topic string, retained bool, payload []byte)
+	Subscribe(topic string, handle func(topic string, payload []byte)) error
+	Disconnect()
+}
+
+// mqttBridge publishes timelight's state and forwards commands to the main loop.
+type mqttBridge struct {
+	log      *slog.Logger
+	client   mqttClient
+	prefix   string
+	clientID string
+
+	// If set, entities are announced to Home Assistant under this prefix.
+	discoveryPrefix string
+
+	mu        sync.Mutex
+	published map[string]string // Last payload of each retained topic.
+	announced map[string]bool   // Discovery topics announced so far.
+}
+
+func (b *mqttBridge) topic(name string) string {
+	return b.prefix + "/" + name
+}
+
+// publish publishes a retained payload, unless it is the same as the last one
+// published to the topic.
+func (b *mqttBridge) publish(name string, payload []byte) {
+	b.publishTo(b.topic(name), payload)
+}
+
+// publishTo is like publish, but takes an absolute topic.
+func (b *mqttBridge) publishTo(topic string, payload []byte) {
+	b.mu.Lock()
+	if b.published[topic] == string(payload) {
+		b.mu.Unlock()
+		return
+	}
+	b.published[topic] = string(payload)
+	b.mu.Unlock()
+
+	b.client.Publish(topic, true, payload)
+}
+
+// clear removes the retained message of a topic.
+func (b *mqttBridge) clear(topic string) {
+	b.mu.Lock()
+	delete(b.published, topic)
+	b.mu.Unlock()
+
+	b.client.Publish(topic, true, []byte{})
+}
+
+func (b *mqttBridge) publishJSON(name string, v any) {
+	b.publishJSONTo(b.topic(name), v)
+}
+
+func (b *mqttBridge) publishJSONTo(topic string, v any) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		b.log.Error("could not encode MQTT payload", slog.String("topic", topic), slog.Any("err", err))
+		return
+	}
+	b.publishTo(topic, payload)
+}
+
+// reset forgets what was published, so that everything is published again,
+// e.g. after reconnecting to a broker which lost its retained messages.
+func (b *mqttBridge) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published = make(map[string]string)
+}
+
+// publishState publishes the target and the state of every light. It must be
+// called from the main loop.
+func (t *Timelight) publishState(now time.Time) {
+	if t.mqtt == nil {
+		return
+	}
+	// Leave out the time, so that the target is only published when it changes.
+	target := t.targetInfo(now)
+	t.mqtt.publishJSON("target", struct {
+		Target      TargetState `json:"target"`
+		Profile     string      `json:"profile"`
+		Paused      bool        `json:"paused"`
+		PausedUntil *time.Time  `json:"paused_until,omitempty"`
+	}{target.Target, target.Profile, target.Paused, target.PausedUntil})
+	for _, l := range t.lights {
+		t.mqtt.publishJSON("lights/"+string(l.ID), lightInfo(l))
+	}
+	if t.mqtt.discoveryPrefix != "" {
+		t.publishRooms()
+	}
+}
+
+func (b *mqttBridge) publishBridgeStatus(connected bool) {
+	status := "offline"
+	if connected {
+		status = "online"
+	}
+	b.publish("bridge", []byte(status))
+}
+
+// publishOverride reports that a light was changed by something else.
+func (t *Timelight) publishOverride(light *Light, now time.Time) {
+	if t.mqtt == nil {
+		return
+	}
+	payload, err := json.Marshal(struct {
+		Light LightID   `json:"light"`
+		Time  time.Time `json:"time"`
+	}{light.ID, now})
+	if err != nil {
+		return
+	}
+	t.mqtt.client.Publish(t.mqtt.topic("override"), false, payload)
+}
+
+// close marks timelight as offline and disconnects from the broker.
+func (b *mqttBridge) close() {
+	b.client.Publish(b.topic("status"), true, []byte("offline"))
+	b.client.Disconnect()
+}
+
+// startMQTT connects to the configured broker.
+func (t *Timelight) startMQTT(ctx context.Context) error {
+	config := t.config.MQTT
+	bridge := newMQTTBridge(t.log, config)
+
+	// Paho runs onConnect as soon as the connection is up, possibly before
+	// connect returns, so the client must be set first.
+	client := newPahoClient(config.Broker, bridge.clientID, config.Username, config.Password,
+		bridge.topic("status"), func() { t.mqttConnected(ctx, bridge) }, t.log)
+	bridge.client = client
+	if err := client.connect(); err != nil {
+		return err
+	}
+	t.mqtt = bridge
+
+	t.log.Info("Connected to MQTT broker", slog.String("broker", config.Broker))
+	return nil
+}
+
+// newMQTTBridge returns a bridge without a client.
+func newMQTTBridge(log *slog.Logger, config MQTTConfig) *mqttBridge {
+	prefix := strings.TrimSuffix(config.TopicPrefix, "/")
+	if prefix == "" {
+		prefix = defaultMQTTTopicPrefix
+	}
+
+	clientID := config.ClientID
+	if clientID == "" {
+		clientID = defaultMQTTClientID
+	}
+
+	bridge := &mqttBridge{
+		log:       log,
+		prefix:    prefix,
+		clientID:  clientID,
+		published: make(map[string]string),
+		announced: make(map[string]bool),
+	}
+	if config.Discovery {
+		bridge.discoveryPrefix = strings.TrimSuffix(config.DiscoveryPrefix, "/")
+		if bridge.discoveryPrefix == "" {
+			bridge.discoveryPrefix = defaultDiscoveryPrefix
+		}
+	}
+	return bridge
+}
+
+// mqttConnected subscribes to commands and republishes everything, whenever the
+// bridge's client (re)connects to the broker.
+func (t *Timelight) mqttConnected(ctx context.Context, bridge *mqttBridge) {
+	bridge.reset()
+	bridge.publish("status", []byte("online"))
+	bridge.publishBridgeStatus(t.bridgeConnected.Load())
+
+	// Commands wait for the main loop, which may itself be publishing, so
+	// they must not block Paho's message handling.
+	err := bridge.client.Subscribe(bridge.topic("cmd/+"), func(topic string, payload []byte) {
+		go t.handleMQTTCommand(ctx, strings.TrimPrefix(topic, bridge.topic("cmd/")), string(payload))
+	})
+	if err != nil {
+		t.log.Error("could not subscribe to MQTT commands", slog.Any("err", err))
+	}
+	if bridge.discoveryPrefix != "" {
+		err := bridge.client.Subscribe(bridge.topic("rooms/+/set"), func(topic string, payload []byte) {
+			id := strings.TrimSuffix(strings.TrimPrefix(topic, bridge.topic("rooms/")), "/set")
+			go t.handleRoomSwitch(ctx, id, string(payload))
+		})
+		if err != nil {
+			t.log.Error("could not subscribe to MQTT room switches", slog.Any("err", err))
+		}
+	}
+
+	// Republish the state from the main loop.
+	go t.do(ctx, func(t *Timelight) error {
+		t.publishDiscovery()
+		t.publishState(time.Now())
+		return nil
+	})
+}
+
+func (t *Timelight) handleMQTTCommand(ctx context.Context, command, arg string) {
+	arg = strings.TrimSpace(arg)
+	t.log.Info("received MQTT command", slog.String("command", command), slog.String("arg", arg))
+
+	ctx, cancel := context.WithTimeout(ctx, mqttCommandTimeout)
+	defer cancel()
+
+	err := t.do(ctx, func(t *Timelight) error {
+		return t.runCommand(command, arg)
+	})
+	if err != nil {
+		t.log.Error("MQTT command failed", slog.String("command", command), slog.Any("err", err))
+	}
+}
+
+var errUnknownCommand = errors.New("unknown command")
+
+// runCommand runs a command received from outside, e.g. over MQTT. It must be
+// called from the main loop.
+func (t *Timelight) runCommand(command, arg string) error {
+	now := time.Now()
+	switch command {
+	case "activate_room", "deactivate_room":
+		ids, err := t.roomLightIDs(arg)
+		if err != nil {
+			return err
+		}
+		if command == "activate_room" {
+			return t.activateLights(now, ids)
+		}
+		return t.deactivateLights(ids)
+	case "activate_light":
+		return t.activateLights(now, []LightID{LightID(arg)})
+	case "deactivate_light":
+		return t.deactivateLights([]LightID{LightID(arg)})
+	case "pause":
+		var until time.Time
+		if arg != "" {
+			d, err := time.ParseDuration(arg)
+			if err != nil || d <= 0 {
+				return errors.New("invalid duration: " + arg)
+			}
+			until = now.Add(d)
+		}
+		t.Pause(until)
+	case "resume":
+		t.Resume()
+		t.runLightUpdate(now, t.spec)
+	case "update":
+		t.runLightUpdate(now, t.spec)
+	case "profile":
+		return t.SetProfile(arg)
+	case "skip_alarm":
+		return t.SkipAlarm(now, arg)
+	default:
+		return errUnknownCommand
+	}
+	return nil
+}
+
+// pahoClient implements mqttClient with the Eclipse Paho client.
+type pahoClient struct {
+	client mqtt.Client
+	log    *slog.Logger
+}
+
+// newPahoClient creates a client which is not connected yet.
+func newPahoClient(broker, clientID, username, password, statusTopic string, onConnect func(), log *slog.Logger) *pahoClient {
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(statusTopic, "offline", 1, true).
+		SetOnConnectHandler(func(mqtt.Client) { onConnect() }).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Warn("lost connection to MQTT broker", slog.Any("err", err))
+		})
+
+	return &pahoClient{client: mqtt.NewClient(opts), log: log}
+}
+
+// connect connects to the broker, waiting up to mqttConnectTimeout.
+func (c *pahoClient) connect() error {
+	token := c.client.Connect()
+	if !token.WaitTimeout(mqttConnectTimeout) {
+		// With SetConnectRetry, the client keeps trying in the background.
+		c.log.Warn("MQTT broker is not reachable yet, retrying in the background")
+		return nil
+	}
+	return token.Error()
+}
+
+func (c *pahoClient) Publish(topic string, retained bool, payload []byte) {
+	token := c.client.Publish(topic, 1, retained, payload)
+	// Don't block the caller; report failures once they are known.
+	go func() {
+		if token.WaitTimeout(mqttConnectTimeout) && token.Error() != nil {
+			c.log.Warn("could not publish to MQTT", slog.String("topic", topic), slog.Any("err", token.Error()))
+		}
+	}()
+}
+
+func (c *pahoClient) Subscribe(topic string, handle func(topic string, payload []byte)) error {
+	token := c.client.Subscribe(topic, 1, func(_ mqtt.Client, msg mqtt.Message) {
+		handle(msg.Topic(), msg.Payload())
+	})
+	token.WaitTimeout(mqttConnectTimeout)
+	return token.Error()
+}
+
+func (c *pahoClient) Disconnect() {
+	c.client.Disconnect(mqttDisconnectQuiesce)
+}
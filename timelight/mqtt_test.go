@@ -0,0 +1,330 @@
+package timelight
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mqttMessage struct {
+	topic    string
+	retained bool
+	payload  string
+}
+
+// fakeMQTT records what is published and delivers messages to subscriptions.
+type fakeMQTT struct {
+	mu        sync.Mutex
+	published []mqttMessage
+	handlers  map[string]func(topic string, payload []byte)
+}
+
+func (c *fakeMQTT) Publish(topic string, retained bool, payload []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, mqttMessage{topic, retained, string(payload)})
+}
+
+func (c *fakeMQTT) Subscribe(topic string, handle func(topic string, payload []byte)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.handlers == nil {
+		c.handlers = make(map[string]func(string, []byte))
+	}
+	c.handlers[topic] = handle
+	return nil
+}
+
+func (c *fakeMQTT) Disconnect() {}
+
+// take returns the messages published since the last call.
+func (c *fakeMQTT) take() []mqttMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	published := c.published
+	c.published = nil
+	return published
+}
+
+// deliver passes a message to the subscription matching the topic, where "+"
+// matches a single level.
+func (c *fakeMQTT) deliver(tb testing.TB, topic, payload string) {
+	tb.Helper()
+	c.mu.Lock()
+	var handle func(string, []byte)
+	for filter, h := range c.handlers {
+		if topicMatches(filter, topic) {
+			handle = h
+		}
+	}
+	c.mu.Unlock()
+	if handle == nil {
+		tb.Fatalf("no subscription for %s", topic)
+	}
+	handle(topic, []byte(payload))
+}
+
+func topicMatches(filter, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	if len(fs) != len(ts) {
+		return false
+	}
+	for i := range fs {
+		if fs[i] != "+" && fs[i] != ts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func topics(msgs []mqttMessage) []string {
+	var ts []string
+	for _, m := range msgs {
+		ts = append(ts, m.topic)
+	}
+	return ts
+}
+
+func newTestMQTT(t *Timelight, config MQTTConfig) *fakeMQTT {
+	client := &fakeMQTT{}
+	t.mqtt = newMQTTBridge(t.log, config)
+	t.mqtt.client = client
+	return client
+}
+
+func TestPublishState(t *testing.T) {
+	tl := newTestTimelight(Config{}, "l1", "l2")
+	client := newTestMQTT(tl, MQTTConfig{TopicPrefix: "home/tl/"})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tl.publishState(now)
+	got := client.take()
+	want := map[string]bool{"home/tl/target": true, "home/tl/lights/l1": true, "home/tl/lights/l2": true}
+	if len(got) != len(want) {
+		t.Fatalf("published %v, want %d topics", topics(got), len(want))
+	}
+	for _, m := range got {
+		if !want[m.topic] || !m.retained {
+			t.Errorf("published %s (retained %v)", m.topic, m.retained)
+		}
+	}
+	if got[0].topic != "home/tl/target" || !strings.Contains(got[0].payload, `"profile":"default"`) {
+		t.Errorf("published %s first, with %s; want the target", got[0].topic, got[0].payload)
+	}
+
+	// Unchanged state is not published again, even as time passes.
+	tl.publishState(now.Add(time.Minute))
+	if got := client.take(); len(got) != 0 {
+		t.Errorf("republished unchanged state: %v", topics(got))
+	}
+
+	tl.lights["l2"].SetInactive()
+	tl.publishState(now)
+	if got := topics(client.take()); len(got) != 1 || got[0] != "home/tl/lights/l2" {
+		t.Errorf("published %v after l2 changed, want only its state", got)
+	}
+
+	tl.Pause(time.Time{})
+	tl.publishState(now)
+	got = client.take()
+	if len(got) != 1 || got[0].topic != "home/tl/target" || !strings.Contains(got[0].payload, `"paused":true`) {
+		t.Errorf("published %v after pausing, want the paused target", got)
+	}
+
+	// After a reset, e.g. on reconnect, everything is published again.
+	tl.mqtt.reset()
+	tl.publishState(now)
+	if got := client.take(); len(got) != 3 {
+		t.Errorf("published %v after reset, want every topic", topics(got))
+	}
+}
+
+func TestPublishOverrideIsNotRetained(t *testing.T) {
+	tl := newTestTimelight(Config{}, "l1")
+	client := newTestMQTT(tl, MQTTConfig{})
+
+	for i := 0; i < 2; i++ {
+		tl.publishOverride(tl.lights["l1"], time.Now())
+	}
+	got := client.take()
+	if len(got) != 2 {
+		t.Fatalf("published %v, want every override", topics(got))
+	}
+	for _, m := range got {
+		if m.topic != "timelight/override" || m.retained {
+			t.Errorf("published %s (retained %v), want timelight/override, not retained", m.topic, m.retained)
+		}
+	}
+}
+
+func TestMQTTConnected(t *testing.T) {
+	tl := newTestTimelight(Config{}, "l1")
+	client := newTestMQTT(tl, MQTTConfig{})
+	ctx := runLoop(t, tl)
+
+	tl.mqttConnected(ctx, tl.mqtt)
+	// Everything is republished from the main loop.
+	published := func(*Timelight) bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(client.published) == 4 // status, bridge, target and l1.
+	}
+	eventually(t, ctx, tl, published)
+	payloads := make(map[string]string)
+	for _, m := range client.take() {
+		payloads[m.topic] = m.payload
+	}
+	if payloads["timelight/status"] != "online" || payloads["timelight/bridge"] != "offline" {
+		t.Errorf("published status %q and bridge %q, want online and offline",
+			payloads["timelight/status"], payloads["timelight/bridge"])
+	}
+
+	// Reconnecting publishes everything again, in case the broker lost it.
+	tl.mqttConnected(ctx, tl.mqtt)
+	eventually(t, ctx, tl, published)
+}
+
+func TestMQTTCommands(t *testing.T) {
+	tl := newTestTimelight(Config{}, "l1")
+	client := newTestMQTT(tl, MQTTConfig{})
+	ctx := runLoop(t, tl)
+	tl.mqttConnected(ctx, tl.mqtt)
+
+	client.deliver(t, "timelight/cmd/pause", " 1h\n")
+	eventually(t, ctx, tl, func(tl *Timelight) bool {
+		return tl.paused && tl.pausedUntil.Sub(time.Now()) > 59*time.Minute
+	})
+
+	client.deliver(t, "timelight/cmd/resume", "")
+	eventually(t, ctx, tl, func(tl *Timelight) bool { return !tl.paused })
+
+	client.deliver(t, "timelight/cmd/deactivate_light", "l1")
+	eventually(t, ctx, tl, func(tl *Timelight) bool { return !tl.lights["l1"].Active })
+}
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		command, arg string
+		wantErr      error // If nil, only whether an error is returned is checked.
+		fails        bool
+		paused       bool
+	}{
+		{command: "pause", paused: true},
+		{command: "pause", arg: "30m", paused: true},
+		{command: "pause", arg: "soon", fails: true},
+		{command: "pause", arg: "-1h", fails: true},
+		{command: "resume"},
+		{command: "update"},
+		{command: "profile", arg: "nope", wantErr: errUnknownProfile},
+		{command: "activate_light", arg: "l9", wantErr: errLightNotFound},
+		{command: "skip_alarm", wantErr: errNoAlarm},
+		{command: "reboot", wantErr: errUnknownCommand},
+		{command: "", wantErr: errUnknownCommand},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command+"/"+tt.arg, func(t *testing.T) {
+			tl := newTestTimelight(Config{}, "l1")
+			err := tl.runCommand(tt.command, tt.arg)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("runCommand(%q, %q) = %v, want %v", tt.command, tt.arg, err, tt.wantErr)
+				}
+			case (err != nil) != tt.fails:
+				t.Errorf("runCommand(%q, %q) = %v, want error: %v", tt.command, tt.arg, err, tt.fails)
+			}
+			if tl.paused != tt.paused {
+				t.Errorf("paused = %v, want %v", tl.paused, tt.paused)
+			}
+		})
+	}
+}
+
+func TestPublishDiscoveryRemovesStaleRooms(t *testing.T) {
+	tl := newTestTimelight(Config{}, "l1", "l2")
+	client := newTestMQTT(tl, MQTTConfig{Discovery: true, DiscoveryPrefix: "ha", ClientID: "tl"})
+	tl.rooms = map[string]roomInfo{
+		"r1": {ID: "r1", Name: "Hall", Lights: []LightID{"l1"}},
+		"r2": {ID: "r2", Name: "Kitchen", Lights: []LightID{"l2"}},
+	}
+	tl.publishDiscovery()
+	client.take()
+
+	// Deleting a room removes its switch, and nothing else is published again.
+	delete(tl.rooms, "r2")
+	tl.publishDiscovery()
+	want := []mqttMessage{{"ha/switch/tl/room_r2/config", true, ""}}
+	if got := client.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+
+	// A room which comes back is announced again.
+	tl.rooms["r2"] = roomInfo{ID: "r2", Name: "Kitchen", Lights: []LightID{"l2"}}
+	tl.publishDiscovery()
+	if got := topics(client.take()); !reflect.DeepEqual(got, []string{"ha/switch/tl/room_r2/config"}) {
+		t.Errorf("published %v, want the kitchen switch", got)
+	}
+}
+
+// waitFor fails the test unless cond becomes true within a few seconds.
+func waitFor(tb testing.TB, what string, cond func() bool) {
+	tb.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			tb.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMQTTBroker(t *testing.T) {
+	broker := newTestBroker(t)
+	tl := newTestTimelight(Config{MQTT: MQTTConfig{Broker: broker.url()}}, "l1")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := tl.startMQTT(ctx); err != nil {
+		t.Fatal(err)
+	}
+	loop := runLoop(t, tl)
+	retained := func(topic, want string) func() bool {
+		return func() bool { got, _, _ := broker.get(topic); return got == want }
+	}
+
+	waitFor(t, "timelight to be online", retained("timelight/status", "online"))
+	waitFor(t, "the bridge status", retained("timelight/bridge", "offline"))
+	waitFor(t, "the light's state", func() bool { got, _, _ := broker.get("timelight/lights/l1"); return got != "" })
+
+	broker.publish(mqttMessage{topic: "timelight/cmd/pause"})
+	eventually(t, loop, tl, func(t *Timelight) bool { return t.paused })
+
+	// The will marks timelight offline when the connection is lost, and it
+	// resubscribes and comes back online once it reconnects.
+	broker.drop()
+	waitFor(t, "a reconnect", func() bool { _, _, connects := broker.get(""); return connects == 2 })
+	waitFor(t, "timelight to be online again", retained("timelight/status", "online"))
+	if _, history, _ := broker.get("timelight/status"); !reflect.DeepEqual(history, []string{"online", "offline", "online"}) {
+		t.Errorf("status was %v, want online, offline from the will, then online", history)
+	}
+	waitFor(t, "resubscribing", func() bool {
+		broker.publish(mqttMessage{topic: "timelight/cmd/resume"})
+		var paused bool
+		tl.do(loop, func(t *Timelight) error { paused = t.paused; return nil })
+		return !paused
+	})
+
+	// Closing marks timelight offline, and disconnects cleanly without the will.
+	tl.mqtt.close()
+	waitFor(t, "disconnecting", func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return len(broker.conns) == 0
+	})
+	if _, history, _ := broker.get("timelight/status"); len(history) != 4 || history[3] != "offline" {
+		t.Errorf("status was %v, want offline once after closing", history)
+	}
+}
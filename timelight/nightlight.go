@@ -0,0 +1,204 @@
+package timelight
+
+import (
+	"time"
+
+	"github.com/aldld/hue/hue"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultPathBrightness = 2
+	defaultPathTimeout    = 2 * time.Minute
+	defaultPathFade       = 1 * time.Minute
+
+	pathOnTransition = 500 * time.Millisecond
+)
+
+// NightLightConfig lights a path at night. Between StartTime and EndTime, which
+// may span midnight, lights turned on by motion, or switched on if PowerOn is
+// set, are set to a dim, warm target instead of the schedule, and fade out once
+// Timeout has passed.
+//
+// Motion triggers with their own night settings use those instead.
+type NightLightConfig struct {
+	StartTime string `toml:"start_time"`
+	EndTime   string `toml:"end_time"`
+
+	// Brightness defaults to 2%, and ColorTempMirek to the warmest color
+	// temperature each light supports.
+	Brightness     *float64 `toml:"brightness"`
+	ColorTempMirek *int     `toml:"color_temp_mirek"`
+
+	// XY, if set, is the color of lights that support color, e.g. [0.7, 0.29]
+	// for a dim red.
+	XY []float64 `toml:"xy"`
+
+	Timeout string `toml:"timeout"` // How long lights stay lit, e.g. "2m"; 2 minutes if empty.
+	Fade    string `toml:"fade"`    // How long lights take to fade out; 1 minute if empty.
+
+	// PowerOn also lights a path with lights that are switched on, e.g. with a
+	// wall switch or the app. If Rooms is set, only lights in those rooms are.
+	PowerOn bool     `toml:"power_on"`
+	Rooms   []string `toml:"rooms"`
+}
+
+func (c NightLightConfig) contains(now time.Time) bool {
+	return inWindow(now, c.StartTime, c.EndTime)
+}
+
+func (c NightLightConfig) timeout() time.Duration {
+	return parsePositiveDuration(c.Timeout, defaultPathTimeout)
+}
+
+func (c NightLightConfig) fade() time.Duration {
+	return parsePositiveDuration(c.Fade, defaultPathFade)
+}
+
+// target returns the night target of a light.
+func (c NightLightConfig) target(light *Light) TargetState {
+	target := StateConfig{Brightness: c.Brightness, ColorTempMirek: c.ColorTempMirek}.TargetState()
+	if !target.HasBrightness {
+		target = target.WithBrightness(defaultPathBrightness)
+	}
+	if !target.HasTempMirek {
+		target = target.WithColorTemp(light.warmestMirek())
+	}
+	if len(c.XY) == 2 {
+		target = target.WithColor(hue.XY{X: c.XY[0], Y: c.XY[1]})
+	}
+	return light.restrictTarget(target)
+}
+
+func (c NightLightConfig) validate(ps *Problems, key string) {
+	if _, err := parseMinuteOfDay(c.StartTime); err != nil {
+		ps.errorf(key+".start_time", "%v", err)
+	}
+	if _, err := parseMinuteOfDay(c.EndTime); err != nil {
+		ps.errorf(key+".end_time", "%v", err)
+	}
+	StateConfig{Brightness: c.Brightness, ColorTempMirek: c.ColorTempMirek}.validate(ps, key)
+	if c.XY != nil {
+		if len(c.XY) != 2 {
+			ps.errorf(key+".xy", "must be a pair of coordinates, e.g. [0.7, 0.29]")
+		} else if c.XY[0] < 0 || c.XY[0] > 1 || c.XY[1] < 0 || c.XY[1] > 1 {
+			ps.errorf(key+".xy", "coordinates must be between 0 and 1")
+		}
+	}
+	for _, d := range []struct{ name, value string }{{"timeout", c.Timeout}, {"fade", c.Fade}} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			ps.errorf(key+"."+d.name, "invalid duration %q", d.value)
+		}
+	}
+	if len(c.Rooms) > 0 && !c.PowerOn {
+		ps.warnf(key+".rooms", "rooms only apply when power_on is set")
+	}
+}
+
+// nightLightActive reports whether lights are triggered by the night light now.
+func (t *Timelight) nightLightActive(now time.Time) bool {
+	return t.config.NightLight != nil && t.config.NightLight.contains(now)
+}
+
+// lightPath turns on the lights which are off at their night target, and keeps
+// the ones it already lit on for longer. Other lights are left alone. It returns
+// the number of lights lit.
+func (t *Timelight) lightPath(now time.Time, ids []LightID) int {
+	nl := t.config.NightLight
+	until := now.Add(nl.timeout())
+
+	var lit int
+	for _, id := range ids {
+		light, ok := t.lights[id]
+		if !ok {
+			continue
+		}
+		path, onPath := t.pathLights[id]
+		if !onPath {
+			path.wasActive = light.Active
+		}
+
+		switch {
+		case !light.On:
+			if err := light.TurnOn(now, nl.target(light), pathOnTransition); err != nil {
+				t.logUpdateError("error while turning on night light", string(id), err)
+				continue
+			}
+			light.SetActive()
+		case onPath && light.Active:
+		default:
+			continue
+		}
+		path.until = until
+		t.pathLights[id] = path
+		lit++
+	}
+
+	if lit > 0 {
+		t.log.Info("lit night path", slog.Int("lights", lit), slog.Time("until", until))
+	}
+	return lit
+}
+
+// handlePowerOn lights a path with a light which was switched on at night. It
+// reports whether the light was lit.
+func (t *Timelight) handlePowerOn(light *Light, now time.Time) bool {
+	nl := t.config.NightLight
+	if nl == nil || !nl.PowerOn || !nl.contains(now) || t.isPaused(now) {
+		return false
+	}
+	if len(nl.Rooms) > 0 && !t.inRooms(light.ID, nl.Rooms) {
+		return false
+	}
+	return t.lightPath(now, []LightID{light.ID}) > 0
+}
+
+func (t *Timelight) inRooms(id LightID, names []string) bool {
+	for _, name := range names {
+		room, ok := t.roomByName(name)
+		if !ok {
+			continue
+		}
+		for _, l := range room.Lights {
+			if l == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkPathLights fades out the lights lit by the night light once their time
+// is up, and restores whether timelight controls them. Lights which were
+// changed manually since are left on.
+func (t *Timelight) checkPathLights(now time.Time) {
+	fade := defaultPathFade
+	if t.config.NightLight != nil {
+		fade = t.config.NightLight.fade()
+	}
+
+	var faded int
+	for id, path := range t.pathLights {
+		if now.Before(path.until) {
+			continue
+		}
+		delete(t.pathLights, id)
+		light, ok := t.lights[id]
+		if !ok || !light.On || !light.Active {
+			continue
+		}
+		if err := light.TurnOff(now, fade); err != nil {
+			t.logUpdateError("error while turning off night light", string(id), err)
+			continue
+		}
+		light.Active = path.wasActive
+		faded++
+	}
+
+	if faded > 0 {
+		t.log.Info("fading out night path", slog.Int("lights", faded), slog.Duration("fade", fade))
+	}
+}
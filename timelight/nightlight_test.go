@@ -0,0 +1,55 @@
+package timelight
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNightPath(t *testing.T) {
+	night := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	config := Config{NightLight: &NightLightConfig{StartTime: "22:00", EndTime: "06:00", PowerOn: true}}
+
+	tests := []struct {
+		name     string
+		inactive bool
+		trigger  func(tl *Timelight)
+	}{
+		{"motion", false, func(tl *Timelight) { tl.motionDetected(tl.motion[0], night) }},
+		{"motion, inactive", true, func(tl *Timelight) { tl.motionDetected(tl.motion[0], night) }},
+		{"power on", true, func(tl *Timelight) { tl.handleLightUpdate(powerUpdate("l1", true), night) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tl := newTestTimelight(config, "l1")
+			tl.motion = []*motionZone{{lights: []LightID{"l1"}, lit: make(map[LightID]bool)}}
+			light := tl.lights["l1"]
+			if tt.inactive {
+				light.SetInactive()
+			}
+
+			tt.trigger(tl)
+			want := config.NightLight.target(light)
+			if !light.On || !light.Active || light.TargetState != want {
+				t.Fatalf("on %v, active %v, target %+v; want on and active at %+v",
+					light.On, light.Active, light.TargetState, want)
+			}
+
+			// The path fades out, and the bridge reports the light off once it has.
+			off := night.Add(defaultPathTimeout)
+			tl.checkPathLights(off)
+			tl.handleLightUpdate(powerUpdate("l1", false), off.Add(defaultPathFade))
+			if light.On || light.Active == tt.inactive {
+				t.Errorf("after fading out: on %v, active %v; want off and active %v",
+					light.On, light.Active, !tt.inactive)
+			}
+			if tl.metrics.overrides != 0 {
+				t.Errorf("%v overrides counted, want none", tl.metrics.overrides)
+			}
+
+			tt.trigger(tl)
+			if !light.On {
+				t.Error("light not lit again")
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package timelight
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/aldld/hue/hue"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	repairInterval = 5 * time.Second
+)
+
+// repair pairs with the bridge again each time it rejects the application key,
+// as soon as someone presses the bridge's link button, and resumes updates with
+// the new key. The key isn't written to the config file, so it is logged to be
+// copied there; otherwise timelight has to pair again after a restart.
+func (t *Timelight) repair(ctx context.Context) {
+	hostname, _ := os.Hostname()
+	deviceType := "timelight#" + hostname
+
+	for {
+		select {
+		case <-t.repairs:
+		case <-ctx.Done():
+			return
+		}
+
+		for t.unauthorized.Load() {
+			creds, err := hue.Pair(t.hue.Addr, deviceType)
+			if err == nil {
+				t.hue.SetAppKey(creds.Username)
+				t.unauthorized.Store(false)
+				t.log.Warn("paired with the bridge again; set bridge.username to keep the new key after a restart",
+					slog.String("username", creds.Username))
+				t.do(ctx, func(t *Timelight) error {
+					t.runLightUpdate(time.Now(), t.spec)
+					return nil
+				})
+				break
+			}
+			if !errors.Is(err, hue.ErrLinkButtonNotPressed) {
+				t.log.Warn("could not pair with the bridge", slog.Any("err", err))
+			}
+
+			select {
+			case <-time.After(repairInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
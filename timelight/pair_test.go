@@ -0,0 +1,42 @@
+package timelight
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aldld/hue/hue"
+)
+
+func TestRepair(t *testing.T) {
+	var deviceType atomic.Value
+	bridge := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			DeviceType string `json:"devicetype"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		deviceType.Store(body.DeviceType)
+		w.Write([]byte(`[{"success": {"username": "new", "clientkey": "key"}}]`))
+	}))
+	defer bridge.Close()
+
+	tl := newTestTimelight(Config{Bridge: BridgeConfig{Addr: bridge.Listener.Addr().String(), Username: "old"}}, "l1")
+	ctx, cancel := context.WithCancel(runLoop(t, tl))
+	defer cancel()
+	go tl.repair(ctx)
+
+	tl.logUpdateError("error while updating light", "l1", &hue.Error{StatusCode: http.StatusForbidden})
+	eventually(t, ctx, tl, func(t *Timelight) bool { return !t.unauthorized.Load() })
+	if tl.hue.AppKey != "new" {
+		t.Errorf("application key = %q, want the new one", tl.hue.AppKey)
+	}
+	if got, _ := deviceType.Load().(string); !strings.HasPrefix(got, "timelight#") {
+		t.Errorf("paired as %q, want timelight#<hostname>", got)
+	}
+	// Updates resume right away.
+	eventually(t, ctx, tl, func(t *Timelight) bool { return t.lights["l1"].TargetState == testTarget })
+}
@@ -0,0 +1,165 @@
+package timelight
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	configPollInterval = 5 * time.Second
+)
+
+// WatchConfig makes Run reload the config from path whenever the file changes
+// or the process receives SIGHUP. It must be called before Run.
+func (t *Timelight) WatchConfig(path string) {
+	t.configPath = path
+}
+
+// watchConfig sends each valid new version of the config file to out. Invalid
+// versions are logged and skipped, so the current config stays in effect.
+func (t *Timelight) watchConfig(ctx context.Context, out chan<- Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	lastMod := t.configModTime()
+	poll := time.NewTicker(configPollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-hup:
+			t.log.Info("received SIGHUP, reloading config")
+
+		case <-poll.C:
+			mod := t.configModTime()
+			if mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+			t.log.Info("config file changed, reloading", slog.String("path", t.configPath))
+		}
+
+		config, problems, err := LoadConfig(t.configPath)
+		if err == nil {
+			err = problems.Err()
+		}
+		if err != nil {
+			t.log.Error("not reloading invalid config", slog.Any("err", err))
+			continue
+		}
+		for _, p := range problems {
+			t.log.Warn("config warning",
+				slog.String("key", p.Key),
+				slog.Int("line", p.Line),
+				slog.String("problem", p.Message),
+			)
+		}
+
+		select {
+		case out <- config:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *Timelight) configModTime() time.Time {
+	info, err := os.Stat(t.configPath)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// applyConfig swaps in a new config, rebuilding the schedule and the set of
+// timelight scenes. Lights keep their active state. If the new scenes cannot be
+// loaded, the previous config stays in effect.
+func (t *Timelight) applyConfig(config Config) error {
+	profile := t.profile
+	if _, ok := config.Profiles[profile]; !ok && profile != DefaultProfile {
+		t.log.Warn("profile was removed, switching to the default",
+			slog.String("profile", profile))
+		profile = DefaultProfile
+	}
+	spec, err := config.ProfileSpec(profile)
+	if err != nil {
+		return err
+	}
+
+	if config.Bridge.Addr != t.config.Bridge.Addr {
+		t.log.Warn("bridge address changed; restart timelight to apply it")
+		config.Bridge.Addr = t.config.Bridge.Addr
+	}
+	if config.DryRun && t.dry == nil {
+		t.log.Warn("dry_run enabled; restart timelight to apply it")
+	}
+	config.DryRun = t.config.DryRun
+	if config.HTTP != t.config.HTTP {
+		t.log.Warn("http settings changed; restart timelight to apply them")
+		config.HTTP = t.config.HTTP
+	}
+	if !reflect.DeepEqual(config.Webhooks, t.config.Webhooks) {
+		t.log.Warn("webhook settings changed; restart timelight to apply them")
+		config.Webhooks = t.config.Webhooks
+	}
+	if config.MQTT != t.config.MQTT {
+		t.log.Warn("mqtt settings changed; restart timelight to apply them")
+		config.MQTT = t.config.MQTT
+	}
+	if config.Logger != t.config.Logger {
+		t.log.Warn("logger settings changed; restart timelight to apply them")
+		config.Logger = t.config.Logger
+	}
+
+	oldConfig, oldSelector, oldGroups, oldScenes := t.config, t.selector, t.groups, t.scenes
+
+	t.config = config
+	// Load the scenes with the new application key, if it was changed. The
+	// key in use may differ from the old config's after pairing again, so it
+	// is only replaced when the config changes it.
+	usernameChanged := config.Bridge.Username != oldConfig.Bridge.Username
+	var oldKey string
+	if usernameChanged {
+		oldKey = t.hue.SetAppKey(config.Bridge.Username)
+	}
+	if err := t.initScenes(); err != nil {
+		t.config, t.selector, t.groups, t.scenes = oldConfig, oldSelector, oldGroups, oldScenes
+		if usernameChanged {
+			t.hue.SetAppKey(oldKey)
+		}
+		return err
+	}
+	if usernameChanged && t.unauthorized.Swap(false) {
+		t.log.Info("application key changed, resuming updates")
+	}
+	t.spec = spec
+	t.profile = profile
+
+	if t.needRooms() {
+		if err := t.loadRooms(); err != nil {
+			t.log.Warn("could not reload rooms", slog.Any("err", err))
+		}
+	}
+	if err := t.loadMotion(); err != nil {
+		t.log.Warn("could not reload motion sensors", slog.Any("err", err))
+	}
+	if err := t.loadSwitches(); err != nil {
+		t.log.Warn("could not reload switches", slog.Any("err", err))
+	}
+	if t.config.MQTT.Discovery {
+		t.publishDiscovery()
+	}
+
+	t.log.Info("reloaded config", slog.Int("scenes", len(t.scenes)))
+	return nil
+}
@@ -0,0 +1,90 @@
+package timelight
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testSchedule is a valid schedule for tests which reload the config.
+var testSchedule = TimelightConfig{
+	Brightness: TransitionConfig{StartTime: "07:00", TransitionTime: "18:00", EndTime: "22:00", StartValue: 100, EndValue: 30},
+	ColorTemp:  TransitionConfig{StartTime: "07:00", TransitionTime: "18:00", EndTime: "22:00", StartValue: 250, EndValue: 450},
+}
+
+// newEmptyBridge returns a bridge without any resources, which rejects the
+// application key "rejected".
+func newEmptyBridge(t *testing.T) *httptest.Server {
+	bridge := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("hue-application-key") == "rejected" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		w.Write([]byte(`{"data": [], "errors": []}`))
+	}))
+	t.Cleanup(bridge.Close)
+	return bridge
+}
+
+func TestApplyConfigUsername(t *testing.T) {
+	bridge := newEmptyBridge(t)
+
+	config := Config{
+		Bridge:    BridgeConfig{Addr: bridge.Listener.Addr().String(), Username: "old"},
+		Timelight: testSchedule,
+	}
+	tl := newTestTimelight(config)
+
+	// A key from pairing again is kept when the username isn't changed.
+	tl.hue.SetAppKey("paired")
+	if err := tl.applyConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if tl.hue.AppKey != "paired" {
+		t.Errorf("application key = %q after reloading, want the paired key", tl.hue.AppKey)
+	}
+
+	// A username the bridge rejects leaves the key in use alone.
+	config.Bridge.Username = "rejected"
+	if err := tl.applyConfig(config); err == nil {
+		t.Error("reloading with a rejected username succeeded")
+	}
+	if tl.hue.AppKey != "paired" || tl.config.Bridge.Username != "old" {
+		t.Errorf("application key = %q, username %q after failing to reload; want the previous ones",
+			tl.hue.AppKey, tl.config.Bridge.Username)
+	}
+
+	// A new username is used, and updates resume with it.
+	tl.unauthorized.Store(true)
+	config.Bridge.Username = "new"
+	if err := tl.applyConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if tl.hue.AppKey != "new" || tl.unauthorized.Load() {
+		t.Errorf("application key = %q, unauthorized %v; want the new key and updates resumed",
+			tl.hue.AppKey, tl.unauthorized.Load())
+	}
+}
+
+func TestApplyConfigKeepsRestartSettings(t *testing.T) {
+	bridge := newEmptyBridge(t)
+	config := Config{
+		Bridge:    BridgeConfig{Addr: bridge.Listener.Addr().String(), Username: "key"},
+		Timelight: testSchedule,
+		Logger:    LoggerConfig{Level: "info"},
+		MQTT:      MQTTConfig{Broker: "tcp://localhost:1883"},
+	}
+	tl := newTestTimelight(config)
+
+	changed := config
+	changed.Bridge.Addr = "192.0.2.1"
+	changed.Logger = LoggerConfig{Level: "debug", Output: "/var/log/timelight.log"}
+	changed.MQTT.Broker = "tcp://192.0.2.1:1883"
+	changed.HTTP.Addr = ":8080"
+	if err := tl.applyConfig(changed); err != nil {
+		t.Fatal(err)
+	}
+	if tl.config.Bridge != config.Bridge || tl.config.Logger != config.Logger ||
+		tl.config.MQTT != config.MQTT || tl.config.HTTP != config.HTTP {
+		t.Errorf("settings which need a restart were applied: %+v", tl.config)
+	}
+}
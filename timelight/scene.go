@@ -1,7 +1,8 @@
 package timelight
 
 import (
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aldld/hue/hue"
@@ -23,41 +24,32 @@ type Scene struct {
 func (t *Timelight) initScenes() error {
 	t.scenes = make(map[SceneID]*Scene) // Reset to empty map.
 
+	selector, err := t.config.Scenes.Selector()
+	if err != nil {
+		return err
+	}
+	t.selector = selector
+
+	t.groups, err = t.groupNames()
+	if err != nil {
+		return err
+	}
+
 	scenes, err := t.hue.GetScenes()
 	if err != nil {
 		return err
 	}
 
 	for _, s := range scenes {
-		if !isTimelightScene(s) {
+		matched, reason := t.selector.Match(s, t.groups)
+		if !matched {
 			continue
 		}
-
-		scene := &Scene{
-			t: t,
-
-			ID:     SceneID(s.ID),
-			Hue:    s,
-			Lights: make(map[LightID]*Light),
-		}
-
-		for _, action := range s.Actions {
-			if action.Target.Type != hue.RTypeLight {
-				continue
-			}
-			lightID := LightID(action.Target.ID)
-			light, ok := t.lights[lightID]
-			if !ok {
-				t.log.Warn("Light not found", slog.String("ID", string(lightID)))
-				continue
-			}
-			scene.Lights[lightID] = light
-		}
-		t.log.Info("Initialized scene",
-			slog.String("name", scene.Hue.Metadata.Name),
-			slog.Int("lights", len(scene.Lights)),
+		t.log.Debug("selected scene",
+			slog.String("id", s.ID),
+			slog.String("reason", reason),
 		)
-		t.scenes[scene.ID] = scene
+		t.addScene(s)
 	}
 
 	t.log.Info("Initialized timelight scenes", slog.Int("count", len(t.scenes)))
@@ -65,39 +57,111 @@ func (t *Timelight) initScenes() error {
 	return nil
 }
 
-func isTimelightScene(scene hue.Scene) bool {
-	return strings.Contains(strings.ToLower(scene.Metadata.Name), "timelight")
+func (t *Timelight) addScene(s hue.Scene) *Scene {
+	scene := &Scene{
+		t: t,
+
+		ID:  SceneID(s.ID),
+		Hue: s,
+	}
+	scene.linkLights()
+
+	t.log.Info("Initialized scene",
+		slog.String("name", scene.Hue.Metadata.Name),
+		slog.Int("lights", len(scene.Lights)),
+	)
+	t.scenes[scene.ID] = scene
+
+	return scene
 }
 
-func (s *Scene) UpdateActions(lightState TargetState) error {
-	newActions := make([]hue.SceneAction, len(s.Hue.Actions))
-	for i, oldAction := range s.Hue.Actions {
-		if oldAction.Target.Type != hue.RTypeLight {
+// linkLights rebuilds the scene's Lights from the targets of its actions.
+func (s *Scene) linkLights() {
+	s.Lights = make(map[LightID]*Light)
+
+	for _, action := range s.Hue.Actions {
+		if action.Target.Type != hue.RTypeLight {
 			continue
 		}
-		lid := LightID(oldAction.Target.ID)
-		light, ok := s.Lights[lid]
+		lightID := LightID(action.Target.ID)
+		light, ok := s.t.lights[lightID]
 		if !ok {
+			s.t.log.Warn("Light not found", slog.String("ID", string(lightID)))
 			continue
 		}
+		s.Lights[lightID] = light
+	}
+}
 
-		newActions[i].Target = oldAction.Target
-		newActions[i].Action.On = &hue.LightOn{On: true}
+// removeLight drops the light's action from the scene.
+func (s *Scene) removeLight(id LightID) {
+	delete(s.Lights, id)
+	actions := make([]hue.SceneAction, 0, len(s.Hue.Actions))
+	for _, action := range s.Hue.Actions {
+		if action.Target.Type != hue.RTypeLight || LightID(action.Target.ID) != id {
+			actions = append(actions, action)
+		}
+	}
+	s.Hue.Actions = actions
+}
 
-		if light.HasBrightness && lightState.HasBrightness {
-			newActions[i].Action.Dimming = &hue.DimmingAction{
-				Brightness: lightState.Brightness,
-			}
+// hasLight reports whether any of the scene's actions target the given light.
+func (s *Scene) hasLight(id LightID) bool {
+	for _, action := range s.Hue.Actions {
+		if action.Target.Type == hue.RTypeLight && LightID(action.Target.ID) == id {
+			return true
 		}
-		if light.HasColorTemperature && lightState.HasTempMirek {
-			newActions[i].Action.ColorTemperature = &hue.ColorTemperatureAction{
-				Mirek: lightState.TempMirek,
-			}
+	}
+	return false
+}
+
+func (t *Timelight) isTimelightScene(scene hue.Scene) bool {
+	matched, _ := t.selector.Match(scene, t.groups)
+	return matched
+}
+
+// sceneAction returns the action which brings the light to the target state.
+func sceneAction(light *Light, target TargetState) hue.Action {
+	action := hue.Action{On: &hue.LightOn{On: true}}
+
+	if light.HasBrightness && target.HasBrightness {
+		action.Dimming = &hue.DimmingAction{
+			Brightness: target.Brightness,
+		}
+	}
+	if light.HasColorTemperature && target.HasTempMirek {
+		action.ColorTemperature = &hue.ColorTemperatureAction{
+			Mirek: target.TempMirek,
 		}
 	}
+	return action
+}
 
-	err := s.t.hue.UpdateScene(s.Hue.ID, hue.SceneUpdate{Actions: &newActions})
-	if err != nil {
+// actions returns the scene's actions with its lights set to the target state.
+// Actions for other targets, e.g. lights timelight doesn't track, are kept.
+func (s *Scene) actions(target TargetState) []hue.SceneAction {
+	actions := make([]hue.SceneAction, 0, len(s.Hue.Actions))
+	for _, oldAction := range s.Hue.Actions {
+		light, ok := s.Lights[LightID(oldAction.Target.ID)]
+		if oldAction.Target.Type != hue.RTypeLight || !ok {
+			actions = append(actions, oldAction)
+			continue
+		}
+		actions = append(actions, hue.SceneAction{
+			Target: oldAction.Target,
+			Action: sceneAction(light, target),
+		})
+	}
+	return actions
+}
+
+func (s *Scene) UpdateActions(lightState TargetState) error {
+	newActions := s.actions(lightState)
+
+	update := hue.SceneUpdate{Actions: &newActions}
+	if s.t.dry != nil {
+		s.t.dry.updateScene(s.ID, update)
+	} else if err := s.t.hue.UpdateScene(s.Hue.ID, update); err != nil {
 		return err
 	}
 
@@ -107,25 +171,50 @@ func (s *Scene) UpdateActions(lightState TargetState) error {
 	return nil
 }
 
-func (t *Timelight) updateScenes(target TargetState) {
+// updateScenes updates every scene to the target state, and returns the number
+// of scenes that could not be updated.
+func (t *Timelight) updateScenes(target TargetState) int {
 	t.log.Info("updating scenes", slog.Any("target", target))
 
-	successes := 0
-	errs := 0
+	var wg sync.WaitGroup
+	var successes, errs atomic.Int32
+	var mu sync.Mutex
+	var deleted []SceneID
 
 	for _, scene := range t.scenes {
-		if err := scene.UpdateActions(target); err != nil {
-			t.log.Error("error while updating scene",
-				slog.String("id", string(scene.ID)),
-				slog.Any("err", err),
-			)
-			errs += 1
-		} else {
-			successes += 1
-		}
+		wg.Add(1)
+		go func(scene *Scene) {
+			defer wg.Done()
+
+			if err := scene.UpdateActions(target); err != nil {
+				t.logUpdateError("error while updating scene", string(scene.ID), err)
+				t.fireWebhooks(WebhookSceneUpdateFailed, "could not update scene", map[string]any{
+					"scene": scene.ID,
+					"name":  scene.Hue.Metadata.Name,
+					"error": err.Error(),
+				})
+				if hue.IsNotFound(err) {
+					mu.Lock()
+					deleted = append(deleted, scene.ID)
+					mu.Unlock()
+				}
+				errs.Add(1)
+			} else {
+				successes.Add(1)
+			}
+		}(scene)
 	}
+	wg.Wait()
+	t.metrics.updateResults(t.metrics.sceneUpdates, int(successes.Load()), int(errs.Load()))
+
+	for _, id := range deleted {
+		delete(t.scenes, id)
+		t.log.Info("removed scene", slog.String("id", string(id)))
+	}
+
 	t.log.Info("finished updating scenes",
-		slog.Int("successes", successes),
-		slog.Int("errs", errs),
+		slog.Int("successes", int(successes.Load())),
+		slog.Int("errs", int(errs.Load())),
 	)
+	return int(errs.Load())
 }
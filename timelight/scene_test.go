@@ -0,0 +1,49 @@
+package timelight
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aldld/hue/hue"
+)
+
+func lightAction(id string, brightness float64) hue.SceneAction {
+	return hue.SceneAction{
+		Target: hue.ResourceRef{ID: id, Type: hue.RTypeLight},
+		Action: hue.Action{On: &hue.LightOn{On: true}, Dimming: &hue.DimmingAction{Brightness: brightness}},
+	}
+}
+
+func TestSceneActions(t *testing.T) {
+	tl := newTestTimelight(Config{}, "l1", "l2")
+	tl.scenes = make(map[SceneID]*Scene)
+	scene := tl.addScene(hue.Scene{
+		ID:       "s1",
+		Metadata: hue.SceneMetadata{Name: "Timelight"},
+		Actions: []hue.SceneAction{
+			lightAction("l1", 10),
+			lightAction("untracked", 10),
+			lightAction("l2", 10),
+		},
+	})
+
+	target := DefaultTargetState.WithBrightness(60)
+	got := scene.actions(target)
+	want := []hue.SceneAction{
+		{Target: hue.ResourceRef{ID: "l1", Type: hue.RTypeLight}, Action: sceneAction(tl.lights["l1"], target)},
+		lightAction("untracked", 10),
+		{Target: hue.ResourceRef{ID: "l2", Type: hue.RTypeLight}, Action: sceneAction(tl.lights["l2"], target)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("actions = %+v, want %+v", got, want)
+	}
+
+	tl.removeLight("l1")
+	got = scene.actions(target)
+	if len(got) != 2 || got[0].Target.ID != "untracked" || got[1].Target.ID != "l2" {
+		t.Errorf("actions after removing l1 = %+v, want untracked and l2", got)
+	}
+	if _, ok := scene.Lights["l1"]; ok {
+		t.Error("scene still links the removed light")
+	}
+}
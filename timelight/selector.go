@@ -0,0 +1,158 @@
+package timelight
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aldld/hue/hue"
+)
+
+const (
+	defaultSceneAppData     = "timelight"
+	defaultSceneNamePattern = "(?i)timelight"
+)
+
+// SceneSelector decides which scenes are controlled by timelight. A scene is
+// selected if it matches any of the configured criteria.
+type SceneSelector struct {
+	ids      map[string]bool
+	rooms    map[string]bool
+	zones    map[string]bool
+	patterns []*regexp.Regexp
+	appData  string
+}
+
+// Selector compiles the scene selection criteria. If none are configured, scenes
+// are selected by the "timelight" app data marker, or by having "timelight" in
+// their name.
+func (c SceneConfig) Selector() (*SceneSelector, error) {
+	if len(c.IDs) == 0 && len(c.Rooms) == 0 && len(c.Zones) == 0 &&
+		len(c.NamePatterns) == 0 && c.AppData == "" {
+		c.AppData = defaultSceneAppData
+		c.NamePatterns = []string{defaultSceneNamePattern}
+	}
+
+	s := &SceneSelector{
+		ids:     toSet(c.IDs, false),
+		rooms:   toSet(c.Rooms, true),
+		zones:   toSet(c.Zones, true),
+		appData: c.AppData,
+	}
+	for _, p := range c.NamePatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scene name pattern %q: %w", p, err)
+		}
+		s.patterns = append(s.patterns, re)
+	}
+
+	return s, nil
+}
+
+func toSet(values []string, fold bool) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		if fold {
+			v = strings.ToLower(v)
+		}
+		set[v] = true
+	}
+	return set
+}
+
+// Match reports whether the scene is selected, and if so, why. groups maps the
+// IDs of rooms and zones to their names.
+func (s *SceneSelector) Match(scene hue.Scene, groups map[string]string) (bool, string) {
+	if s.ids[scene.ID] {
+		return true, "scene ID is listed in scenes.ids"
+	}
+
+	groupName := strings.ToLower(groups[scene.Group.ID])
+	switch scene.Group.Type {
+	case hue.RTypeRoom:
+		if s.rooms[groupName] {
+			return true, fmt.Sprintf("room %q is listed in scenes.rooms", groups[scene.Group.ID])
+		}
+	case hue.RTypeZone:
+		if s.zones[groupName] {
+			return true, fmt.Sprintf("zone %q is listed in scenes.zones", groups[scene.Group.ID])
+		}
+	}
+
+	if s.appData != "" && scene.Metadata.AppData == s.appData {
+		return true, fmt.Sprintf("app data is %q", s.appData)
+	}
+
+	for _, re := range s.patterns {
+		if re.MatchString(scene.Metadata.Name) {
+			return true, fmt.Sprintf("name matches %q", re.String())
+		}
+	}
+
+	return false, "no criteria matched"
+}
+
+// SceneMatch is the result of matching a scene against the scene selector.
+type SceneMatch struct {
+	ID      string
+	Name    string
+	Group   string
+	Matched bool
+	Reason  string
+}
+
+// MatchScenes fetches every scene from the bridge and reports which of them are
+// selected by the configured criteria.
+func (t *Timelight) MatchScenes() ([]SceneMatch, error) {
+	selector, err := t.config.Scenes.Selector()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := t.groupNames()
+	if err != nil {
+		return nil, err
+	}
+	scenes, err := t.hue.GetScenes()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]SceneMatch, len(scenes))
+	for i, s := range scenes {
+		matched, reason := selector.Match(s, groups)
+		matches[i] = SceneMatch{
+			ID:      s.ID,
+			Name:    s.Metadata.Name,
+			Group:   groups[s.Group.ID],
+			Matched: matched,
+			Reason:  reason,
+		}
+	}
+	return matches, nil
+}
+
+// groupNames returns the names of all rooms and zones, keyed by ID.
+func (t *Timelight) groupNames() (map[string]string, error) {
+	rooms, err := hue.List[hue.Room](t.hue)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := hue.List[hue.Zone](t.hue)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(rooms)+len(zones))
+	for _, r := range rooms {
+		if r.Metadata != nil {
+			names[r.ID] = r.Metadata.Name
+		}
+	}
+	for _, z := range zones {
+		if z.Metadata != nil {
+			names[z.ID] = z.Metadata.Name
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,371 @@
+package timelight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	serverShutdownTimeout = 5 * time.Second
+)
+
+// The HTTP API exposes timelight's state as JSON:
+//
+//	GET  /api/target                 Current target state.
+//	GET  /api/lights                 Tracked lights.
+//	GET  /api/scenes                 Timelight scenes.
+//	GET  /api/events                 Recent events from the bridge.
+//	POST /api/lights/{id}/activate   Start controlling a light.
+//	POST /api/lights/{id}/deactivate Stop controlling a light.
+//	POST /api/rooms/{name}/activate  Start controlling the lights in a room.
+//	POST /api/rooms/{name}/deactivate
+//	POST /api/pause[?for=duration]   Stop updating lights and scenes.
+//	POST /api/resume
+//	POST /api/profile?name=profile   Switch to another schedule.
+//	GET  /api/alarms                 Wake-up alarms and when they next ring.
+//	POST /api/alarms/{name}/skip     Skip the next ring of an alarm.
+//	POST /api/alarms/{name}/unskip
+//	GET  /api/biases                 Biases which have not decayed yet.
+//	POST /api/bias[?room=name|light=id][&brightness=percent][&mirek=offset]
+//	                                 Replace the bias of a room, a light or every
+//	                                 light; omitted values are zero.
+//	POST /api/update                 Update lights and scenes immediately.
+//	GET  /metrics                    Metrics in the Prometheus text format.
+//
+// Requests are handled on the main loop, so state is never read while it is
+// being modified.
+
+type apiTarget struct {
+	Time        time.Time   `json:"time"`
+	Target      TargetState `json:"target"`
+	Profile     string      `json:"profile"`
+	Paused      bool        `json:"paused"`
+	PausedUntil *time.Time  `json:"paused_until,omitempty"`
+
+	// Unauthorized is set once the bridge rejects the application key, until
+	// timelight has paired with the bridge again.
+	Unauthorized bool `json:"unauthorized"`
+}
+
+func (t *Timelight) targetInfo(now time.Time) apiTarget {
+	target := apiTarget{
+		Time:    now,
+		Target:  t.spec.TargetLightState(now),
+		Profile: t.profile,
+		Paused:  t.isPaused(now),
+
+		Unauthorized: t.unauthorized.Load(),
+	}
+	if target.Paused {
+		target.PausedUntil = optionalTime(t.pausedUntil)
+	}
+	return target
+}
+
+type apiLight struct {
+	ID                  LightID     `json:"id"`
+	Active              bool        `json:"active"`
+	HasBrightness       bool        `json:"has_brightness"`
+	HasColorTemperature bool        `json:"has_color_temperature"`
+	LastUpdated         *time.Time  `json:"last_updated,omitempty"`
+	TargetState         TargetState `json:"target_state"`
+}
+
+func lightInfo(l *Light) apiLight {
+	return apiLight{
+		ID:                  l.ID,
+		Active:              l.Active,
+		HasBrightness:       l.HasBrightness,
+		HasColorTemperature: l.HasColorTemperature,
+		LastUpdated:         optionalTime(l.LastUpdated),
+		TargetState:         l.TargetState,
+	}
+}
+
+type apiScene struct {
+	ID          SceneID     `json:"id"`
+	Name        string      `json:"name"`
+	Group       string      `json:"group,omitempty"`
+	Lights      []LightID   `json:"lights"`
+	LastUpdated *time.Time  `json:"last_updated,omitempty"`
+	TargetState TargetState `json:"target_state"`
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// serve runs the HTTP API until ctx is done.
+func (t *Timelight) serve(ctx context.Context, addr string) {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: t.apiHandler(),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	t.log.Info("Starting HTTP server", slog.String("addr", addr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		t.log.Error("HTTP server failed", slog.Any("err", err))
+	}
+}
+
+func (t *Timelight) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", t.handleMetrics)
+	mux.HandleFunc("/api/target", t.handleGet(func(t *Timelight) any {
+		return t.targetInfo(time.Now())
+	}))
+	mux.HandleFunc("/api/lights", t.handleGet(func(t *Timelight) any {
+		lights := make([]apiLight, 0, len(t.lights))
+		for _, l := range t.lights {
+			lights = append(lights, lightInfo(l))
+		}
+		sort.Slice(lights, func(i, j int) bool { return lights[i].ID < lights[j].ID })
+		return lights
+	}))
+	mux.HandleFunc("/api/scenes", t.handleGet(func(t *Timelight) any {
+		scenes := make([]apiScene, 0, len(t.scenes))
+		for _, s := range t.scenes {
+			scene := apiScene{
+				ID:          s.ID,
+				Name:        s.Hue.Metadata.Name,
+				Group:       t.groups[s.Hue.Group.ID],
+				Lights:      make([]LightID, 0, len(s.Lights)),
+				LastUpdated: optionalTime(s.LastUpdated),
+				TargetState: s.TargetState,
+			}
+			for id := range s.Lights {
+				scene.Lights = append(scene.Lights, id)
+			}
+			sort.Slice(scene.Lights, func(i, j int) bool { return scene.Lights[i] < scene.Lights[j] })
+			scenes = append(scenes, scene)
+		}
+		sort.Slice(scenes, func(i, j int) bool { return scenes[i].Name < scenes[j].Name })
+		return scenes
+	}))
+	mux.HandleFunc("/api/events", t.handleGet(func(t *Timelight) any {
+		events := make([]RecentEvent, len(t.recentEvents))
+		copy(events, t.recentEvents)
+		return events
+	}))
+
+	mux.HandleFunc("/api/lights/", t.handlePost(func(t *Timelight, r *http.Request) error {
+		id, action, err := splitAction(r.URL.Path, "/api/lights/")
+		if err != nil {
+			return err
+		}
+		return t.setActive(action, []LightID{LightID(id)})
+	}))
+	mux.HandleFunc("/api/rooms/", t.handlePost(func(t *Timelight, r *http.Request) error {
+		name, action, err := splitAction(r.URL.Path, "/api/rooms/")
+		if err != nil {
+			return err
+		}
+		ids, err := t.roomLightIDs(name)
+		if errors.Is(err, errRoomNotFound) {
+			return notFound(err)
+		}
+		if err != nil {
+			return err
+		}
+		return t.setActive(action, ids)
+	}))
+	mux.HandleFunc("/api/pause", t.handlePost(func(t *Timelight, r *http.Request) error {
+		var until time.Time
+		if s := r.URL.Query().Get("for"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return badRequest(errors.New("invalid duration: " + s))
+			}
+			until = time.Now().Add(d)
+		}
+		t.Pause(until)
+		return nil
+	}))
+	mux.HandleFunc("/api/resume", t.handlePost(func(t *Timelight, r *http.Request) error {
+		t.Resume()
+		t.runLightUpdate(time.Now(), t.spec)
+		return nil
+	}))
+	mux.HandleFunc("/api/profile", t.handlePost(func(t *Timelight, r *http.Request) error {
+		err := t.SetProfile(r.URL.Query().Get("name"))
+		if errors.Is(err, errUnknownProfile) {
+			return notFound(err)
+		}
+		return err
+	}))
+	mux.HandleFunc("/api/alarms", t.handleGet(func(t *Timelight) any {
+		return t.Alarms(time.Now())
+	}))
+	mux.HandleFunc("/api/alarms/", t.handlePost(func(t *Timelight, r *http.Request) error {
+		name, action, err := splitAction(r.URL.Path, "/api/alarms/")
+		if err != nil {
+			return err
+		}
+		switch action {
+		case "skip":
+			err = t.SkipAlarm(time.Now(), name)
+		case "unskip":
+			err = t.UnskipAlarm(name)
+		default:
+			return notFound(errors.New("unknown action: " + action))
+		}
+		if errors.Is(err, errAlarmNotFound) || errors.Is(err, errNoAlarm) {
+			return notFound(err)
+		}
+		return err
+	}))
+	mux.HandleFunc("/api/biases", t.handleGet(func(t *Timelight) any {
+		return t.Biases(time.Now())
+	}))
+	mux.HandleFunc("/api/bias", t.handlePost(func(t *Timelight, r *http.Request) error {
+		q := r.URL.Query()
+		var bias Bias
+		for _, p := range []struct {
+			name  string
+			value *float64
+		}{{"brightness", &bias.Brightness}, {"mirek", &bias.Mirek}} {
+			s := q.Get(p.name)
+			if s == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return badRequest(errors.New("invalid " + p.name + ": " + s))
+			}
+			*p.value = v
+		}
+		err := t.SetBias(time.Now(), q.Get("room"), LightID(q.Get("light")), bias)
+		if errors.Is(err, errRoomNotFound) || errors.Is(err, errLightNotFound) {
+			return notFound(err)
+		}
+		return err
+	}))
+	mux.HandleFunc("/api/update", t.handlePost(func(t *Timelight, r *http.Request) error {
+		t.runLightUpdate(time.Now(), t.spec)
+		return nil
+	}))
+
+	return mux
+}
+
+func (t *Timelight) setActive(action string, ids []LightID) error {
+	var err error
+	switch action {
+	case "activate":
+		err = t.activateLights(time.Now(), ids)
+	case "deactivate":
+		err = t.deactivateLights(ids)
+	default:
+		return notFound(errors.New("unknown action: " + action))
+	}
+	if errors.Is(err, errLightNotFound) {
+		return notFound(err)
+	}
+	return err
+}
+
+// splitAction splits "{prefix}{name}/{action}" into name and action.
+func splitAction(path, prefix string) (string, string, error) {
+	rest := strings.TrimPrefix(path, prefix)
+	i := strings.LastIndex(rest, "/")
+	if i <= 0 {
+		return "", "", notFound(errors.New("not found: " + path))
+	}
+	return rest[:i], rest[i+1:], nil
+}
+
+// httpError is an error with an HTTP status code.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e httpError) Error() string { return e.err.Error() }
+
+func notFound(err error) error   { return httpError{http.StatusNotFound, err} }
+func badRequest(err error) error { return httpError{http.StatusBadRequest, err} }
+
+func (t *Timelight) handleGet(f func(t *Timelight) any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, errorBody("method not allowed"))
+			return
+		}
+		var result any
+		err := t.do(r.Context(), func(t *Timelight) error {
+			result = f(t)
+			return nil
+		})
+		if err != nil {
+			t.writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func (t *Timelight) handlePost(f func(t *Timelight, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, errorBody("method not allowed"))
+			return
+		}
+		err := t.do(r.Context(), func(t *Timelight) error {
+			return f(t, r)
+		})
+		if err != nil {
+			t.writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	}
+}
+
+func (t *Timelight) writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var httpErr httpError
+	switch {
+	case errors.As(err, &httpErr):
+		status = httpErr.status
+	case errors.Is(err, errNotRunning):
+		status = http.StatusServiceUnavailable
+	}
+	if status == http.StatusInternalServerError {
+		t.log.Error("API request failed", slog.Any("err", err))
+	}
+	writeJSON(w, status, errorBody(err.Error()))
+}
+
+func errorBody(msg string) map[string]string {
+	return map[string]string{"error": msg}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,126 @@
+package timelight
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	maxCheckpointAge = 2 * time.Minute
+)
+
+type checkpoint struct {
+	Time        time.Time                   `json:"time"`
+	LastEventID string                      `json:"last_event_id"`
+	Profile     string                      `json:"profile,omitempty"`
+	Lights      map[LightID]lightCheckpoint `json:"lights"`
+}
+
+type lightCheckpoint struct {
+	Active      bool        `json:"active"`
+	LastUpdated time.Time   `json:"last_updated"`
+	TargetState TargetState `json:"target_state"`
+}
+
+// saveState writes the state of every light to the configured state file.
+func (t *Timelight) saveState(now time.Time) error {
+	path := t.config.Shutdown.StateFile
+	if path == "" || t.dry != nil {
+		// In dry-run mode the tracked state was never applied, so it must not
+		// replace a real checkpoint.
+		return nil
+	}
+
+	cp := checkpoint{
+		Time:        now,
+		LastEventID: t.lastEventId,
+		Profile:     t.profile,
+		Lights:      make(map[LightID]lightCheckpoint, len(t.lights)),
+	}
+	for id, light := range t.lights {
+		cp.Lights[id] = lightCheckpoint{
+			Active:      light.Active,
+			LastUpdated: light.LastUpdated,
+			TargetState: light.TargetState,
+		}
+	}
+
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a crash never leaves a partial
+	// state file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	t.log.Info("saved state", slog.String("path", path), slog.Int("lights", len(cp.Lights)))
+	return nil
+}
+
+// restoreState restores the state of each light from the state file, if it was
+// written recently. Lights which no longer exist are ignored.
+func (t *Timelight) restoreState(now time.Time) error {
+	path := t.config.Shutdown.StateFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return err
+	}
+	if age := now.Sub(cp.Time); age > maxCheckpointAge {
+		t.log.Info("state file is too old, not restoring", slog.Duration("age", age))
+		return nil
+	}
+
+	restored := 0
+	for id, lc := range cp.Lights {
+		light, ok := t.lights[id]
+		if !ok {
+			continue
+		}
+		light.Active = lc.Active
+		light.LastUpdated = lc.LastUpdated
+		light.TargetState = lc.TargetState
+		restored++
+	}
+	t.lastEventId = cp.LastEventID
+	if cp.Profile != "" {
+		t.profile = cp.Profile
+	}
+
+	t.log.Info("restored state", slog.String("path", path), slog.Int("lights", restored))
+	return nil
+}
@@ -0,0 +1,118 @@
+package timelight
+
+import (
+	"time"
+
+	"github.com/aldld/hue/hue"
+)
+
+// LightStatus is the current state of a light as reported by the bridge.
+type LightStatus struct {
+	ID   string
+	Name string
+
+	HasBrightness       bool
+	HasColorTemperature bool
+	HasColor            bool
+
+	On         bool
+	Brightness float64
+	Mirek      int
+	MirekValid bool
+
+	// Scenes is the number of timelight scenes containing the light.
+	Scenes int
+}
+
+// Status is a snapshot of the bridge compared against the schedule.
+type Status struct {
+	Time   time.Time
+	Target TargetState
+	Lights []LightStatus
+	Scenes []SceneMatch // Only the scenes selected by the configuration.
+}
+
+// FollowsTarget reports whether the light's state is close to the target.
+func (l LightStatus) FollowsTarget(target TargetState) bool {
+	if !l.On {
+		return false
+	}
+	if l.HasBrightness && target.HasBrightness && !within(l.Brightness, target.Brightness, 2) {
+		return false
+	}
+	if l.HasColorTemperature && target.HasTempMirek {
+		if !l.MirekValid || !within(float64(l.Mirek), float64(target.TempMirek), 10) {
+			return false
+		}
+	}
+	return true
+}
+
+// Status queries the bridge for the current state of every light and scene.
+func (t *Timelight) Status(now time.Time) (Status, error) {
+	var status Status
+
+	spec, err := t.config.Timelight.Spec()
+	if err != nil {
+		return status, err
+	}
+	lights, err := t.hue.GetLights()
+	if err != nil {
+		return status, err
+	}
+	matches, err := t.MatchScenes()
+	if err != nil {
+		return status, err
+	}
+	scenes, err := t.hue.GetScenes()
+	if err != nil {
+		return status, err
+	}
+
+	selected := make(map[string]bool)
+	for _, m := range matches {
+		if m.Matched {
+			selected[m.ID] = true
+			status.Scenes = append(status.Scenes, m)
+		}
+	}
+	sceneCounts := make(map[string]int)
+	for _, s := range scenes {
+		if !selected[s.ID] {
+			continue
+		}
+		for _, action := range s.Actions {
+			if action.Target.Type == hue.RTypeLight {
+				sceneCounts[action.Target.ID]++
+			}
+		}
+	}
+
+	status.Time = now
+	status.Target = spec.TargetLightState(now)
+	for _, l := range lights {
+		ls := LightStatus{
+			ID:                  l.ID,
+			HasBrightness:       l.Dimming != nil,
+			HasColorTemperature: l.ColorTemperature != nil,
+			HasColor:            l.Color != nil,
+			Scenes:              sceneCounts[l.ID],
+		}
+		if l.Metadata != nil {
+			ls.Name = l.Metadata.Name
+		}
+		if l.On != nil {
+			ls.On = l.On.On
+		}
+		if l.Dimming != nil {
+			ls.Brightness = l.Dimming.Brightness
+		}
+		if l.ColorTemperature != nil {
+			ls.Mirek = l.ColorTemperature.Mirek
+			ls.MirekValid = l.ColorTemperature.MirekValid
+		}
+		status.Lights = append(status.Lights, ls)
+	}
+
+	return status, nil
+}
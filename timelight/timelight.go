@@ -1,46 +1,146 @@
 package timelight
 
 import (
-	"golang.org/x/exp/slog"
+	"context"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/exp/slog"
+
 	"github.com/aldld/hue/hue"
 )
 
 const (
 	lightUpdateInterval = 1 * time.Minute
+	timerCheckInterval  = 5 * time.Second // Motion timeouts, night lights, alarms and biases.
+	rateLimitBackoff    = 30 * time.Second
 )
 
-// Periodically checkpoint (every 1 minute?) the following data to disk:
-//   - Last event ID from the event stream
-//   - State of all lights being tracked
-//   - Timestamp
-// On startup, check if checkpoint file exists and timestamp is not older than ~2min(?)
-// Restore state of lights being tracked, and resume stream with Last-Event-Id header
+// State is checkpointed to disk on shutdown (see state.go), and restored on
+// startup if it is recent enough.
+// TODO: Also checkpoint periodically, and resume stream with Last-Event-Id header.
 
 type Timelight struct {
-	log    *slog.Logger
-	config Config
+	log        *slog.Logger
+	config     Config
+	configPath string // If set, the config is reloaded when this file changes.
+	spec       Spec
+	profile    string // Name of the profile spec was built from.
 
 	hue         *hue.Client
+	metrics     *metrics
+	mqtt        *mqttBridge // Set if MQTT is enabled.
+	webhooks    []*webhook
+	dry         *dryRun // Set in dry-run mode.
 	lastEventId string
 
 	scenes map[SceneID]*Scene
 	lights map[LightID]*Light
+
+	selector *SceneSelector
+	groups   map[string]string   // Names of rooms and zones, keyed by ID.
+	rooms    map[string]roomInfo // Loaded only for Home Assistant discovery and motion.
+
+	motion     []*motionZone
+	pathLights map[LightID]litLight  // Lights lit by the night light, until they fade out.
+	wakeLights map[LightID]litLight  // Lights ramping up for an alarm, until the alarm time.
+	alarms     map[string]alarmState // Keyed by alarm name.
+
+	switches    map[string]switchInfo // Buttons and rotaries, keyed by ID. Loaded only for bindings.
+	biases      map[biasScope]biasEntry
+	dirtyBiases map[biasScope]bool // Scopes whose lights flushBiases updates.
+
+	// Updates are skipped until this time after the bridge reports that it is
+	// rate limited.
+	throttledUntil atomic.Value // time.Time
+
+	// Set once the bridge rejects the application key. Scheduled updates are
+	// skipped until timelight has paired with the bridge again; see repair.
+	unauthorized atomic.Bool
+	repairs      chan struct{} // Wakes up repair.
+
+	// Updates are skipped while paused, until pausedUntil if it is set.
+	paused      bool
+	pausedUntil time.Time
+
+	recentEvents []RecentEvent
+
+	// Whether the bridge's event stream is connected.
+	bridgeConnected atomic.Bool
+
+	commands chan func(*Timelight) // Run on the main loop; see do.
+	stopped  chan struct{}         // Closed when Run returns.
 }
 
 func New(log *slog.Logger, config Config) *Timelight {
+	t := &Timelight{
+		log:     log.With(slog.String(componentKey, componentCore)),
+		config:  config,
+		metrics: newMetrics(),
+
+		pathLights: make(map[LightID]litLight),
+		wakeLights: make(map[LightID]litLight),
+		alarms:     make(map[string]alarmState),
+		biases:     make(map[biasScope]biasEntry),
+
+		repairs:  make(chan struct{}, 1),
+		commands: make(chan func(*Timelight)),
+		stopped:  make(chan struct{}),
+	}
+
 	hueConfig := hue.Config{
 		Addr:   config.Bridge.Addr,
 		AppKey: config.Bridge.Username,
+		Hooks:  t.hueHooks(),
 	}
-	hueClient := hue.NewClient(log, hueConfig)
+	t.hue = hue.NewClient(log.With(slog.String(componentKey, componentHue)), hueConfig)
 
-	return &Timelight{
-		log:    log,
-		config: config,
-		hue:    hueClient,
+	if config.DryRun {
+		t.dry = newDryRun(t.log, t.hue)
 	}
+	for _, c := range config.Webhooks {
+		w, err := newWebhook(t.log, c)
+		if err != nil {
+			t.log.Error("invalid webhook, ignoring it", slog.String("url", c.URL), slog.Any("err", err))
+			continue
+		}
+		t.webhooks = append(t.webhooks, w)
+	}
+	return t
+}
+
+// hueHooks records metrics and tracks whether the bridge's event stream is
+// connected.
+func (t *Timelight) hueHooks() hue.Hooks {
+	hooks := t.metrics.hooks()
+	connect, disconnect := hooks.Connect, hooks.Disconnect
+	hooks.Connect = func() {
+		connect()
+		t.setBridgeConnected(true)
+		t.fireWebhooks(WebhookBridgeConnected, "connected to the bridge", nil)
+	}
+	hooks.Disconnect = func(err error) {
+		disconnect(err)
+		if !t.setBridgeConnected(false) {
+			return // Another attempt to reconnect failed.
+		}
+		var data map[string]any
+		if err != nil {
+			data = map[string]any{"error": err.Error()}
+		}
+		t.fireWebhooks(WebhookBridgeDisconnected, "lost connection to the bridge", data)
+	}
+	return hooks
+}
+
+// setBridgeConnected records the state of the bridge connection, and reports
+// whether it changed. It is called from the event listener, not the main loop.
+func (t *Timelight) setBridgeConnected(connected bool) bool {
+	changed := t.bridgeConnected.Swap(connected) != connected
+	if t.mqtt != nil {
+		t.mqtt.publishBridgeStatus(connected)
+	}
+	return changed
 }
 
 func filterEvent(event hue.Event) bool {
@@ -49,12 +149,15 @@ func filterEvent(event hue.Event) bool {
 	// Scene added, modified, deleted
 	// Scene recalled
 
-	if event.Type != "update" {
+	switch event.Type {
+	case "add", "update", "delete":
+	default:
 		return false
 	}
 
 	for _, r := range event.Data {
-		if r.Type() == hue.RTypeScene || r.Type() == hue.RTypeLight {
+		switch r.Type() {
+		case hue.RTypeScene, hue.RTypeLight, hue.RTypeMotion, hue.RTypeButton, hue.RTypeRelativeRotary:
 			return true
 		}
 	}
@@ -62,11 +165,32 @@ func filterEvent(event hue.Event) bool {
 	return false
 }
 
-func (t *Timelight) Run() error {
+// initSpec restores the state saved in the state file, and builds the schedule
+// of the profile which was active, or of the default profile.
+func (t *Timelight) initSpec(now time.Time) error {
+	t.profile = DefaultProfile
+	if err := t.restoreState(now); err != nil {
+		t.log.Warn("could not restore state", slog.Any("err", err))
+	}
+	spec, err := t.config.ProfileSpec(t.profile)
+	if err != nil {
+		t.log.Warn("could not restore profile, using the default",
+			slog.String("profile", t.profile), slog.Any("err", err))
+		t.profile = DefaultProfile
+		spec, err = t.config.ProfileSpec(t.profile)
+		if err != nil {
+			return err
+		}
+	}
+	t.spec = spec
+	return nil
+}
+
+// Run controls the lights until ctx is done, then shuts down gracefully.
+func (t *Timelight) Run(ctx context.Context) error {
 	t.log.Info("Starting Timelight")
 
-	spec, err := t.config.Timelight.Spec()
-	if err != nil {
+	if _, err := t.config.Timelight.Spec(); err != nil {
 		return err
 	}
 
@@ -77,26 +201,208 @@ func (t *Timelight) Run() error {
 	if err := t.initScenes(); err != nil {
 		return err
 	}
+	if err := t.initSpec(time.Now()); err != nil {
+		return err
+	}
+
+	// Connect to MQTT before listening for events, since the listener reports
+	// the bridge's connection state over MQTT.
+	if t.needRooms() {
+		if err := t.loadRooms(); err != nil {
+			return err
+		}
+	}
+	if err := t.loadMotion(); err != nil {
+		return err
+	}
+	if err := t.loadSwitches(); err != nil {
+		return err
+	}
+	if t.config.MQTT.Broker != "" {
+		if err := t.startMQTT(ctx); err != nil {
+			t.log.Error("could not connect to MQTT broker", slog.Any("err", err))
+		}
+	}
+
+	for _, w := range t.webhooks {
+		go w.run(ctx)
+	}
+	go t.repair(ctx)
 
 	bridgeEvents := make(chan hue.Event, 8)
-	go t.hue.EventListener(filterEvent, bridgeEvents)
+	if t.dry != nil {
+		t.log.Warn("Dry run: changes will be logged but not sent to the bridge")
+		go t.dry.listen(ctx, bridgeEvents)
+	} else {
+		go t.hue.EventListener(ctx, filterEvent, bridgeEvents)
+	}
+
+	configs := make(chan Config)
+	if t.configPath != "" {
+		go t.watchConfig(ctx, configs)
+	}
+
+	if t.config.HTTP.Addr != "" {
+		go t.serve(ctx, t.config.HTTP.Addr)
+	}
+
+	// Once asked to stop, give in-flight updates until the deadline to finish.
+	// Past that, cancel them so the loop below gets a chance to exit.
+	defer close(t.stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-t.stopped:
+			return
+		}
+		timer := time.NewTimer(t.config.Shutdown.timeout())
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			t.hue.Shutdown(ctx)
+		case <-t.stopped:
+		}
+	}()
 
-	t.runLightUpdate(time.Now(), spec)
+	t.runLightUpdate(time.Now(), t.spec)
 
-	lightUpdate := time.Tick(lightUpdateInterval)
+	lightUpdate := time.NewTicker(lightUpdateInterval)
+	defer lightUpdate.Stop()
+	timers := time.NewTicker(timerCheckInterval)
+	defer timers.Stop()
+	var biasFlush <-chan time.Time
 	for {
+		if len(t.dirtyBiases) > 0 && biasFlush == nil {
+			biasFlush = time.After(biasFlushDelay)
+		}
 		select {
 		case event := <-bridgeEvents:
 			t.handleEvent(event)
 
-		case <-lightUpdate:
-			t.runLightUpdate(time.Now(), spec)
+		case <-lightUpdate.C:
+			t.runLightUpdate(time.Now(), t.spec)
+
+		case <-timers.C:
+			now := time.Now()
+			t.checkMotionTimeouts(now)
+			t.checkPathLights(now)
+			t.checkAlarms(now)
+			t.expireBiases(now)
+
+		case <-biasFlush:
+			biasFlush = nil
+			t.flushBiases(time.Now())
+
+		case config := <-configs:
+			if err := t.applyConfig(config); err != nil {
+				t.log.Error("error while applying config, keeping previous config",
+					slog.Any("err", err))
+				continue
+			}
+			t.runLightUpdate(time.Now(), t.spec)
+
+		case cmd := <-t.commands:
+			cmd(t)
+
+		case <-ctx.Done():
+			return t.shutdown()
 		}
+
+		t.publishState(time.Now())
 	}
 }
 
+// needRooms reports whether rooms can be referred to by name, e.g. in the
+// config or the API, so that rooms need to be loaded.
+func (t *Timelight) needRooms() bool {
+	nl := t.config.NightLight
+	return t.config.MQTT.Discovery || t.config.HTTP.Addr != "" || len(t.config.Motion) > 0 ||
+		len(t.config.Alarms) > 0 || len(t.config.Bindings) > 0 || (nl != nil && len(nl.Rooms) > 0)
+}
+
+// shutdown optionally restores active lights to the configured state, saves the
+// state of every light, and waits for outstanding updates to finish.
+func (t *Timelight) shutdown() error {
+	timeout := t.config.Shutdown.timeout()
+	t.log.Info("Shutting down", slog.Duration("timeout", timeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if restore := t.config.Shutdown.Restore; restore != nil {
+		t.log.Info("restoring lights", slog.Any("target", restore.TargetState()))
+		t.updateLights(time.Now(), restore.TargetState())
+	}
+
+	if err := t.saveState(time.Now()); err != nil {
+		t.log.Error("could not save state", slog.Any("err", err))
+	}
+
+	if err := t.hue.Shutdown(ctx); err != nil {
+		t.log.Warn("some updates were cancelled", slog.Any("err", err))
+	}
+
+	if t.mqtt != nil {
+		t.mqtt.close()
+	}
+
+	t.log.Info("Stopped Timelight")
+	return nil
+}
+
 func (t *Timelight) runLightUpdate(now time.Time, spec Spec) {
+	if t.isPaused(now) {
+		t.log.Debug("paused, skipping update")
+		return
+	}
+	if t.unauthorized.Load() {
+		t.log.Debug("waiting to pair with the bridge again, skipping update")
+		return
+	}
+	if until, ok := t.throttledUntil.Load().(time.Time); ok && now.Before(until) {
+		t.log.Info("bridge is rate limiting requests, skipping update",
+			slog.Time("until", until))
+		return
+	}
+
 	target := spec.TargetLightState(now)
 	t.updateLights(now, target)
 	t.updateScenes(target)
 }
+
+// logUpdateError logs a failed update of the given resource, with advice on how
+// to recover from errors which are not transient.
+func (t *Timelight) logUpdateError(msg string, id string, err error) {
+	switch {
+	case hue.IsUnauthorized(err):
+		if t.unauthorized.CompareAndSwap(false, true) {
+			t.log.Error("bridge rejected the application key; press the bridge's link button to pair again, until then updates are skipped",
+				slog.String("id", id),
+				slog.Any("err", err),
+			)
+			select {
+			case t.repairs <- struct{}{}:
+			default:
+			}
+		} else {
+			t.log.Debug(msg, slog.String("id", id), slog.Any("err", err))
+		}
+	case hue.IsRateLimited(err), hue.IsBridgeBusy(err):
+		t.throttledUntil.Store(time.Now().Add(rateLimitBackoff))
+		t.log.Warn(msg,
+			slog.String("id", id),
+			slog.Any("err", err),
+			slog.Duration("backoff", rateLimitBackoff),
+		)
+	case hue.IsNotFound(err):
+		t.log.Warn("resource no longer exists on the bridge",
+			slog.String("id", id),
+			slog.Any("err", err),
+		)
+	default:
+		t.log.Error(msg,
+			slog.String("id", id),
+			slog.Any("err", err),
+		)
+	}
+}
@@ -0,0 +1,106 @@
+package timelight
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/aldld/hue/hue"
+)
+
+// constSpec targets the same state all day.
+type constSpec TargetState
+
+func (s constSpec) TargetLightState(time.Time) TargetState {
+	return TargetState(s)
+}
+
+var testTarget = DefaultTargetState.WithBrightness(50).WithColorTemp(300)
+
+// newTestTimelight returns a Timelight in dry-run mode, so that updates are
+// logged instead of sent, with the given lights tracked and active.
+func newTestTimelight(config Config, ids ...LightID) *Timelight {
+	config.DryRun = true
+	t := New(slog.New(slog.NewTextHandler(io.Discard, nil)), config)
+	t.spec = constSpec(testTarget)
+	t.profile = DefaultProfile
+	t.lights = make(map[LightID]*Light)
+	for _, id := range ids {
+		t.lights[id] = &Light{
+			dry:                 t.dry,
+			ID:                  id,
+			Active:              true,
+			HasBrightness:       true,
+			HasColorTemperature: true,
+		}
+	}
+	return t
+}
+
+// runLoop runs commands sent with do until the test ends, standing in for the
+// main loop.
+func runLoop(tb testing.TB, t *Timelight) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	tb.Cleanup(cancel)
+	go func() {
+		for {
+			select {
+			case cmd := <-t.commands:
+				cmd(t)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ctx
+}
+
+// eventually fails the test unless cond, run on the main loop, becomes true
+// within a second.
+func eventually(tb testing.TB, ctx context.Context, t *Timelight, cond func(t *Timelight) bool) {
+	tb.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		var ok bool
+		if err := t.do(ctx, func(t *Timelight) error { ok = cond(t); return nil }); err != nil {
+			tb.Fatal(err)
+		}
+		if ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	tb.Fatal("condition not met within a second")
+}
+
+func TestUnauthorizedSkipsUpdates(t *testing.T) {
+	tl := newTestTimelight(Config{}, "l1")
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	forbidden := &hue.Error{Method: "PUT", Endpoint: "/light/l1", StatusCode: 403}
+
+	tl.logUpdateError("error while updating light", "l1", forbidden)
+	tl.logUpdateError("error while updating light", "l1", forbidden)
+	if !tl.unauthorized.Load() || !tl.targetInfo(now).Unauthorized {
+		t.Fatal("not marked as unauthorized")
+	}
+	tl.runLightUpdate(now, tl.spec)
+	if got := tl.lights["l1"].TargetState; got != (TargetState{}) {
+		t.Errorf("light updated to %+v while unauthorized", got)
+	}
+
+	// Other errors don't stop updates.
+	tl.unauthorized.Store(false)
+	tl.logUpdateError("error while updating light", "l1", &hue.Error{StatusCode: 500})
+	tl.runLightUpdate(now, tl.spec)
+	if got := tl.lights["l1"].TargetState; got == (TargetState{}) {
+		t.Error("light not updated")
+	}
+}
+
+// powerUpdate is the update the bridge reports when a light is switched.
+func powerUpdate(id LightID, on bool) hue.Light {
+	return hue.Light{ID: string(id), On: &hue.LightOn{On: on}}
+}
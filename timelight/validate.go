@@ -0,0 +1,424 @@
+package timelight
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/exp/slog"
+)
+
+// Problem is an issue found while validating the config.
+type Problem struct {
+	Key     string // TOML key path, e.g. "timelight.brightness.start_time".
+	Line    int    // Line of the key in the config file, or 0 if unknown.
+	Message string
+	Warning bool // Warnings do not prevent the config from being used.
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s: %s", p.Line, p.severity(), p.Key, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.severity(), p.Key, p.Message)
+}
+
+// InFile formats the problem like a compiler error in the file at path, e.g.
+// "timelight.toml:12: error: motion[0].timeout: invalid duration".
+func (p Problem) InFile(path string) string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s: %s", path, p.Line, p.severity(), p.Key, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", path, p.severity(), p.Key, p.Message)
+}
+
+func (p Problem) severity() string {
+	if p.Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+type Problems []Problem
+
+func (ps *Problems) errorf(key string, format string, args ...any) {
+	*ps = append(*ps, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (ps *Problems) warnf(key string, format string, args ...any) {
+	*ps = append(*ps, Problem{Key: key, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+// Err returns a *ValidationError if any of the problems are errors.
+func (ps Problems) Err() error {
+	for _, p := range ps {
+		if !p.Warning {
+			return &ValidationError{Problems: ps}
+		}
+	}
+	return nil
+}
+
+// ValidationError is returned when the config contains errors.
+type ValidationError struct {
+	Problems Problems
+}
+
+func (e *ValidationError) Error() string {
+	var errs []string
+	for _, p := range e.Problems {
+		if !p.Warning {
+			errs = append(errs, p.String())
+		}
+	}
+	return fmt.Sprintf("invalid config:\n  %s", strings.Join(errs, "\n  "))
+}
+
+// LoadConfig reads the config file at path and validates it. An error is only
+// returned if the file cannot be read or parsed; problems found while validating
+// its contents are returned separately.
+func LoadConfig(path string) (Config, Problems, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, nil, err
+	}
+	md, err := toml.Decode(string(data), &config)
+	if err != nil {
+		return config, nil, err
+	}
+
+	problems := config.Validate()
+	for _, key := range unknownKeys(md) {
+		problems.errorf(key, "unknown key")
+	}
+
+	lines := keyLines(data)
+	for i := range problems {
+		problems[i].Line = lines.find(problems[i].Key)
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+
+	return config, problems, nil
+}
+
+// unknownKeys returns the keys in the file which do not correspond to any config
+// field. Only the outermost unknown table is reported.
+func unknownKeys(md toml.MetaData) []string {
+	var keys []string
+	for _, key := range md.Undecoded() {
+		k := key.String()
+		covered := false
+		for _, parent := range keys {
+			if strings.HasPrefix(k, parent+".") {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Validate checks the config for values which are out of range or inconsistent.
+func (c Config) Validate() Problems {
+	var ps Problems
+
+	c.Logger.validate(&ps, "logger")
+
+	if c.Bridge.Addr == "" {
+		ps.errorf("bridge.addr", "bridge address is required")
+	}
+	if c.Bridge.Username == "" {
+		ps.errorf("bridge.username", "username is required; run `timelight pair` to create one")
+	}
+
+	c.Timelight.Brightness.validate(&ps, "timelight.brightness", MinBrightness, MaxBrightness)
+	c.Timelight.ColorTemp.validate(&ps, "timelight.color_temp", MinMirek, MaxMirek)
+
+	for name, profile := range c.Profiles {
+		key := "profiles." + name
+		if name == DefaultProfile {
+			ps.errorf(key, "%q is reserved for the schedule in [timelight]", name)
+			continue
+		}
+		profile.Brightness.validate(&ps, key+".brightness", MinBrightness, MaxBrightness)
+		profile.ColorTemp.validate(&ps, key+".color_temp", MinMirek, MaxMirek)
+	}
+
+	if c.MQTT.Broker != "" {
+		if u, err := url.Parse(c.MQTT.Broker); err != nil || u.Scheme == "" || u.Host == "" {
+			ps.errorf("mqtt.broker", "invalid broker URL %q; use e.g. tcp://localhost:1883", c.MQTT.Broker)
+		}
+		if strings.ContainsAny(c.MQTT.TopicPrefix, "#+") {
+			ps.errorf("mqtt.topic_prefix", "must not contain wildcards")
+		}
+	}
+
+	for i, w := range c.Webhooks {
+		w.validate(&ps, fmt.Sprintf("webhooks[%d]", i))
+	}
+
+	for i, m := range c.Motion {
+		m.validate(&ps, fmt.Sprintf("motion[%d]", i))
+	}
+	if c.NightLight != nil {
+		c.NightLight.validate(&ps, "night_light")
+	}
+	alarmNames := make(map[string]bool)
+	for i, a := range c.Alarms {
+		key := fmt.Sprintf("alarms[%d]", i)
+		a.validate(&ps, key)
+		if name := strings.ToLower(a.Name); name != "" {
+			if alarmNames[name] {
+				ps.errorf(key+".name", "duplicate alarm name %q", a.Name)
+			}
+			alarmNames[name] = true
+		}
+	}
+	for i, b := range c.Bindings {
+		b.validate(&ps, fmt.Sprintf("bindings[%d]", i))
+	}
+	if c.Bias.Decay != "" {
+		if d, err := time.ParseDuration(c.Bias.Decay); err != nil || d <= 0 {
+			ps.errorf("bias.decay", "invalid duration %q", c.Bias.Decay)
+		}
+	}
+	if c.Bias.Timeout != "" {
+		if d, err := time.ParseDuration(c.Bias.Timeout); err != nil || d <= 0 {
+			ps.errorf("bias.timeout", "invalid duration %q", c.Bias.Timeout)
+		} else if c.Bias.Decay != "" {
+			ps.warnf("bias.timeout", "ignored, since decay is set")
+		} else {
+			ps.warnf("bias.timeout", "renamed to decay; biases now fade out over it")
+		}
+	}
+	for i, d := range c.Holidays {
+		if _, err := time.Parse(holidayLayout, d); err != nil {
+			ps.errorf(fmt.Sprintf("holidays[%d]", i), "invalid date %q; use e.g. \"2026-12-25\"", d)
+		}
+	}
+
+	if c.Shutdown.Timeout != "" {
+		if d, err := time.ParseDuration(c.Shutdown.Timeout); err != nil || d <= 0 {
+			ps.errorf("shutdown.timeout", "invalid duration %q", c.Shutdown.Timeout)
+		}
+	}
+	if c.Shutdown.Restore != nil {
+		c.Shutdown.Restore.validate(&ps, "shutdown.restore")
+	}
+
+	if c.HTTP.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.HTTP.Addr); err != nil {
+			ps.errorf("http.addr", "invalid address: %v", err)
+		}
+	}
+
+	for i, p := range c.Scenes.NamePatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			ps.errorf(fmt.Sprintf("scenes.name_patterns[%d]", i), "invalid pattern: %v", err)
+		}
+	}
+
+	return ps
+}
+
+func (c TransitionConfig) validate(ps *Problems, key string, min, max float64) {
+	times := []struct {
+		name  string
+		value string
+	}{
+		{"start_time", c.StartTime},
+		{"transition_time", c.TransitionTime},
+		{"end_time", c.EndTime},
+	}
+
+	minutes := make([]int, len(times))
+	valid := true
+	for i, t := range times {
+		m, err := parseMinuteOfDay(t.value)
+		if err != nil {
+			ps.errorf(key+"."+t.name, "%v", err)
+			valid = false
+		}
+		minutes[i] = m
+	}
+	if valid {
+		if err := checkTransitionOrder(minutes[0], minutes[1], minutes[2]); err != nil {
+			ps.errorf(key, "%v", err)
+		}
+	}
+
+	values := []struct {
+		name  string
+		value int
+	}{
+		{"start_value", c.StartValue},
+		{"end_value", c.EndValue},
+	}
+	for _, v := range values {
+		if float64(v.value) < min || float64(v.value) > max {
+			ps.errorf(key+"."+v.name, "%d is outside the range %v to %v", v.value, min, max)
+		}
+	}
+}
+
+func (c LoggerConfig) validate(ps *Problems, key string) {
+	if _, err := c.SlogLevel(); err != nil {
+		ps.errorf(key+".level", "%v", err)
+	}
+	levels := []struct {
+		name  string
+		value string
+	}{
+		{"hue", c.Levels.Hue},
+		{"core", c.Levels.Core},
+	}
+	for _, l := range levels {
+		if _, err := parseLevel(l.value, slog.LevelInfo); err != nil {
+			ps.errorf(key+".levels."+l.name, "%v", err)
+		}
+	}
+
+	switch c.Format {
+	case "", logFormatText, logFormatLogfmt, logFormatJSON:
+	default:
+		ps.errorf(key+".format", "unknown format %q; use text, logfmt or json", c.Format)
+	}
+
+	if c.MaxSizeMB < 0 {
+		ps.errorf(key+".max_size_mb", "must not be negative")
+	}
+	if c.MaxFiles < 0 {
+		ps.errorf(key+".max_files", "must not be negative")
+	}
+	if isStdStream(c.Output) && (c.MaxSizeMB != 0 || c.MaxFiles != 0) {
+		ps.warnf(key+".output", "rotation settings only apply when logging to a file")
+	}
+}
+
+func (c StateConfig) validate(ps *Problems, key string) {
+	if c.Brightness != nil {
+		b := *c.Brightness
+		if b < MinBrightness || b > MaxBrightness {
+			ps.warnf(key+".brightness", "%v is outside the range %d to %d and will be clamped",
+				b, MinBrightness, MaxBrightness)
+		}
+	}
+	if c.ColorTempMirek != nil {
+		t := *c.ColorTempMirek
+		if t < MinMirek || t > MaxMirek {
+			ps.warnf(key+".color_temp_mirek", "%d is outside the range %d to %d and will be clamped",
+				t, MinMirek, MaxMirek)
+		}
+	}
+}
+
+// lineIndex maps TOML key paths to the line on which they are defined. Keys in
+// arrays of tables are recorded both with and without their index, e.g.
+// "webhooks[1].url" and "webhooks.url".
+type lineIndex map[string]int
+
+// keyLines finds the line of each table header and key assignment in a TOML
+// document. It only understands the subset of TOML used by config files: one
+// key or header per line, with bare or quoted keys.
+func keyLines(data []byte) lineIndex {
+	lines := make(lineIndex)
+	arrayCounts := make(map[string]int)
+
+	table := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+
+		case strings.HasPrefix(line, "[["):
+			name := normalizeKey(strings.Trim(strings.SplitN(line, "]]", 2)[0], "[ "))
+			table = fmt.Sprintf("%s[%d]", name, arrayCounts[name])
+			arrayCounts[name]++
+			lines.add(table, n)
+
+		case strings.HasPrefix(line, "["):
+			table = inArray(normalizeKey(strings.Trim(strings.SplitN(line, "]", 2)[0], "[ ")), arrayCounts)
+			lines.add(table, n)
+
+		default:
+			eq := strings.Index(line, "=")
+			if eq < 0 {
+				continue
+			}
+			key := normalizeKey(line[:eq])
+			if table != "" {
+				key = table + "." + key
+			}
+			lines.add(key, n)
+		}
+	}
+	return lines
+}
+
+// inArray adds the index of the current element of an enclosing array of
+// tables to a table name, e.g. "motion.night" after the second [[motion]]
+// becomes "motion[1].night".
+func inArray(name string, arrayCounts map[string]int) string {
+	for array, count := range arrayCounts {
+		if strings.HasPrefix(name, array+".") {
+			return fmt.Sprintf("%s[%d]%s", array, count-1, name[len(array):])
+		}
+	}
+	return name
+}
+
+var arrayIndex = regexp.MustCompile(`\[\d+\]`)
+
+func (l lineIndex) add(key string, line int) {
+	if _, ok := l[key]; !ok {
+		l[key] = line
+	}
+	if stripped := arrayIndex.ReplaceAllString(key, ""); stripped != key {
+		if _, ok := l[stripped]; !ok {
+			l[stripped] = line
+		}
+	}
+}
+
+// find returns the line of key, or of its closest enclosing table. Keys in
+// arrays of tables fall back to the first element defining them.
+func (l lineIndex) find(key string) int {
+	for _, k := range []string{key, arrayIndex.ReplaceAllString(key, "")} {
+		for k != "" {
+			if line, ok := l[k]; ok {
+				return line
+			}
+			i := strings.LastIndexAny(k, ".[")
+			if i < 0 {
+				break
+			}
+			k = k[:i]
+		}
+	}
+	return 0
+}
+
+func normalizeKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, p := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(p), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
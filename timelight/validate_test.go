@@ -0,0 +1,173 @@
+package timelight
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyLines(t *testing.T) {
+	tests := []struct {
+		name string
+		toml string
+		want lineIndex
+	}{
+		{
+			name: "tables and keys",
+			toml: `# Comment.
+log_level = "info"
+
+[timelight.brightness]
+start_time = "07:00"
+  end_time = "22:00"  # Indented.
+`,
+			want: lineIndex{
+				"log_level":                       2,
+				"timelight.brightness":            4,
+				"timelight.brightness.start_time": 5,
+				"timelight.brightness.end_time":   6,
+			},
+		},
+		{
+			name: "quoted keys",
+			toml: `[profiles."movie night"]
+"brightness" = 20
+'color_temp_mirek'=400
+[ "bridge" ]
+addr = "hue.local"
+`,
+			want: lineIndex{
+				"profiles.movie night":                  1,
+				"profiles.movie night.brightness":       2,
+				"profiles.movie night.color_temp_mirek": 3,
+				"bridge":                                4,
+				"bridge.addr":                           5,
+			},
+		},
+		{
+			name: "arrays of tables",
+			toml: `[[webhooks]]
+url = "https://a.example"
+
+[[motion]]
+rooms = ["Hall"]
+
+[[webhooks]]
+url = "https://b.example"
+[webhooks.headers]
+x = "y"
+
+[[motion]]
+[motion.night]
+start_time = "23:00"
+`,
+			want: lineIndex{
+				"webhooks[0]":                1,
+				"webhooks[0].url":            2,
+				"webhooks":                   1,
+				"webhooks.url":               2,
+				"motion[0]":                  4,
+				"motion[0].rooms":            5,
+				"motion":                     4,
+				"motion.rooms":               5,
+				"webhooks[1]":                7,
+				"webhooks[1].url":            8,
+				"webhooks[1].headers":        9,
+				"webhooks.headers":           9,
+				"webhooks[1].headers.x":      10,
+				"webhooks.headers.x":         10,
+				"motion[1]":                  12,
+				"motion[1].night":            13,
+				"motion.night":               13,
+				"motion[1].night.start_time": 14,
+				"motion.night.start_time":    14,
+			},
+		},
+		{
+			name: "first definition wins",
+			toml: `a = 1
+a = 2
+`,
+			want: lineIndex{"a": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyLines([]byte(tt.toml)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keyLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineIndexFind(t *testing.T) {
+	lines := keyLines([]byte(`[[alarms]]
+name = "weekday"
+
+[[alarms]]
+name = "weekend"
+time = "09:00"
+`))
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"alarms[1].time", 6},
+		{"alarms[1].name", 5},
+		{"alarms[1].days", 4}, // Not set, so its table.
+		{"alarms[0].time", 1},
+		{"bridge.addr", 0},
+	}
+	for _, tt := range tests {
+		if got := lines.find(tt.key); got != tt.want {
+			t.Errorf("find(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestProblemInFile(t *testing.T) {
+	tests := []struct {
+		problem Problem
+		want    string
+	}{
+		{
+			Problem{Key: "motion[0].timeout", Line: 12, Message: `invalid duration "5"`},
+			`timelight.toml:12: error: motion[0].timeout: invalid duration "5"`,
+		},
+		{
+			Problem{Key: "bias.timeout", Message: "renamed to decay", Warning: true},
+			"timelight.toml: warning: bias.timeout: renamed to decay",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.problem.InFile("timelight.toml"); got != tt.want {
+			t.Errorf("InFile() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestLineIndexFindInSubtable(t *testing.T) {
+	lines := keyLines([]byte(`[[motion]]
+rooms = ["Hall"]
+[motion.night]
+timeout = "1m"
+
+[[motion]]
+rooms = ["Kitchen"]
+[motion.night]
+start_time = "23:00"
+`))
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"motion[0].night.timeout", 4},
+		{"motion[1].night.start_time", 9},
+		{"motion[1].night.timeout", 8},
+		{"motion[1].rooms", 7},
+	}
+	for _, tt := range tests {
+		if got := lines.find(tt.key); got != tt.want {
+			t.Errorf("find(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+}
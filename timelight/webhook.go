@@ -0,0 +1,358 @@
+package timelight
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Webhook event types.
+const (
+	WebhookOverride           = "override"
+	WebhookBridgeConnected    = "bridge_connected"
+	WebhookBridgeDisconnected = "bridge_disconnected"
+	WebhookSceneUpdateFailed  = "scene_update_failed"
+)
+
+var webhookEventTypes = []string{
+	WebhookOverride,
+	WebhookBridgeConnected,
+	WebhookBridgeDisconnected,
+	WebhookSceneUpdateFailed,
+}
+
+const (
+	webhookQueueSize          = 64
+	defaultWebhookAttempts    = 5
+	defaultWebhookTimeout     = 10 * time.Second
+	webhookInitialBackoff     = 1 * time.Second
+	webhookMaxBackoff         = 1 * time.Minute
+	webhookSignatureHeader    = "X-Timelight-Signature"
+	webhookEventHeader        = "X-Timelight-Event"
+	webhookDeadLetterFileMode = 0o644
+)
+
+// WebhookConfig configures a URL which is sent a POST request for each matching
+// event.
+type WebhookConfig struct {
+	URL string `toml:"url"`
+
+	// Events are the types of event to send; every type if empty.
+	Events []string `toml:"events"`
+
+	// Template is a text/template rendering the JSON body from a WebhookEvent,
+	// e.g. `{"text": {{json .Message}}}`. The event is sent as JSON if empty.
+	Template string `toml:"template"`
+
+	// Secret, if set, signs the body with HMAC-SHA256. The signature is sent in
+	// the X-Timelight-Signature header as "sha256=<hex>".
+	Secret string `toml:"secret"`
+
+	MaxAttempts int    `toml:"max_attempts"` // 5 if zero.
+	Timeout     string `toml:"timeout"`      // Per attempt; 10s if empty.
+
+	// DeadLetterFile, if set, is appended a JSON line for each event which could
+	// not be delivered. Failed deliveries are always logged.
+	DeadLetterFile string `toml:"dead_letter_file"`
+}
+
+// WebhookEvent is the data sent to webhooks.
+type WebhookEvent struct {
+	Type    string         `json:"type"`
+	Time    time.Time      `json:"time"`
+	Message string         `json:"message"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func (c WebhookConfig) template() (*template.Template, error) {
+	if c.Template == "" {
+		return nil, nil
+	}
+	return template.New("webhook").Funcs(webhookFuncs).Parse(c.Template)
+}
+
+func (c WebhookConfig) timeout() time.Duration {
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil || d <= 0 {
+		return defaultWebhookTimeout
+	}
+	return d
+}
+
+func (c WebhookConfig) validate(ps *Problems, key string) {
+	if c.URL == "" {
+		ps.errorf(key+".url", "url is required")
+	}
+	for _, e := range c.Events {
+		if !contains(webhookEventTypes, e) {
+			ps.errorf(key+".events", "unknown event %q", e)
+		}
+	}
+	if _, err := c.template(); err != nil {
+		ps.errorf(key+".template", "%v", err)
+	}
+	if c.MaxAttempts < 0 {
+		ps.errorf(key+".max_attempts", "must not be negative")
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			ps.errorf(key+".timeout", "invalid duration %q", c.Timeout)
+		}
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// webhook delivers events to a single URL, one at a time, in the order they
+// were fired.
+type webhook struct {
+	log      *slog.Logger
+	config   WebhookConfig
+	template *template.Template
+	client   *http.Client
+	queue    chan WebhookEvent
+
+	deadLetterMu sync.Mutex
+}
+
+func newWebhook(log *slog.Logger, config WebhookConfig) (*webhook, error) {
+	tmpl, err := config.template()
+	if err != nil {
+		return nil, err
+	}
+	return &webhook{
+		log:      log.With(slog.String("webhook", config.URL)),
+		config:   config,
+		template: tmpl,
+		client:   &http.Client{Timeout: config.timeout()},
+		queue:    make(chan WebhookEvent, webhookQueueSize),
+	}, nil
+}
+
+func (w *webhook) wants(eventType string) bool {
+	return len(w.config.Events) == 0 || contains(w.config.Events, eventType)
+}
+
+// fire queues the event without blocking. If the queue is full, the event is
+// dead-lettered.
+func (w *webhook) fire(event WebhookEvent) {
+	select {
+	case w.queue <- event:
+	default:
+		w.deadLetter(event, fmt.Errorf("queue is full"))
+	}
+}
+
+// run delivers queued events until ctx is done, then dead-letters the events
+// still queued.
+func (w *webhook) run(ctx context.Context) {
+	for {
+		select {
+		case event := <-w.queue:
+			if err := w.deliver(ctx, event); err != nil {
+				w.deadLetter(event, err)
+			}
+		case <-ctx.Done():
+			w.drain(ctx.Err())
+			return
+		}
+	}
+}
+
+func (w *webhook) drain(reason error) {
+	for {
+		select {
+		case event := <-w.queue:
+			w.deadLetter(event, reason)
+		default:
+			return
+		}
+	}
+}
+
+// deliver sends the event, retrying with exponential backoff unless the
+// receiver rejects it.
+func (w *webhook) deliver(ctx context.Context, event WebhookEvent) error {
+	body, err := w.body(event)
+	if err != nil {
+		return err
+	}
+
+	attempts := w.config.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultWebhookAttempts
+	}
+	backoff := webhookInitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := w.send(ctx, event.Type, body)
+		if err == nil {
+			w.log.Debug("delivered webhook", slog.String("event", event.Type))
+			return nil
+		}
+		var statusErr *webhookStatusError
+		if errors.As(err, &statusErr) && statusErr.permanent() {
+			return err
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		w.log.Warn("webhook delivery failed, retrying",
+			slog.String("event", event.Type),
+			slog.Int("attempt", attempt),
+			slog.Duration("retry_after", backoff),
+			slog.Any("err", err),
+		)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+}
+
+func (w *webhook) body(event WebhookEvent) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(event)
+	}
+	var buf bytes.Buffer
+	if err := w.template.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("template did not produce valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *webhook) send(ctx context.Context, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, eventType)
+	if w.config.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+sign(w.config.Secret, body))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &webhookStatusError{code: res.StatusCode, status: res.Status}
+	}
+	return nil
+}
+
+// webhookStatusError is returned for responses without a 2xx status.
+type webhookStatusError struct {
+	code   int
+	status string
+}
+
+func (e *webhookStatusError) Error() string {
+	return "status " + e.status
+}
+
+// permanent reports whether retrying won't help: the receiver rejected the
+// request, rather than timing out or limiting the rate of requests.
+func (e *webhookStatusError) permanent() bool {
+	switch e.code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return e.code >= 400 && e.code < 500
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deadLetter records an event which could not be delivered.
+func (w *webhook) deadLetter(event WebhookEvent, reason error) {
+	w.log.Error("could not deliver webhook",
+		slog.String("event", event.Type),
+		slog.String("message", event.Message),
+		slog.Any("err", reason),
+	)
+	if w.config.DeadLetterFile == "" {
+		return
+	}
+
+	line, err := json.Marshal(struct {
+		URL    string       `json:"url"`
+		Error  string       `json:"error"`
+		Failed time.Time    `json:"failed"`
+		Event  WebhookEvent `json:"event"`
+	}{w.config.URL, reason.Error(), time.Now(), event})
+	if err != nil {
+		return
+	}
+
+	w.deadLetterMu.Lock()
+	defer w.deadLetterMu.Unlock()
+	f, err := os.OpenFile(w.config.DeadLetterFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, webhookDeadLetterFileMode)
+	if err != nil {
+		w.log.Error("could not write dead letter", slog.Any("err", err))
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		w.log.Error("could not write dead letter", slog.Any("err", err))
+	}
+}
+
+// fireWebhooks sends an event to every webhook which wants it. It may be called
+// from any goroutine.
+func (t *Timelight) fireWebhooks(eventType, message string, data map[string]any) {
+	event := WebhookEvent{
+		Type:    eventType,
+		Time:    time.Now(),
+		Message: message,
+		Data:    data,
+	}
+	for _, w := range t.webhooks {
+		if w.wants(eventType) {
+			w.fire(event)
+		}
+	}
+}
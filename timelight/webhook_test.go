@@ -0,0 +1,142 @@
+package timelight
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/exp/slog"
+)
+
+func newTestWebhook(t *testing.T, config WebhookConfig) *webhook {
+	t.Helper()
+	w, err := newWebhook(slog.New(slog.NewTextHandler(io.Discard, nil)), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// deadLetters returns the errors recorded in a dead-letter file.
+func deadLetters(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var reasons []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		reasons = append(reasons, line.Error)
+	}
+	return reasons
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		status   int
+		attempts int32
+	}{
+		{http.StatusBadRequest, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusRequestTimeout, 2},
+		{http.StatusTooManyRequests, 2},
+		{http.StatusServiceUnavailable, 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			t.Parallel() // Retries wait a second.
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			w := newTestWebhook(t, WebhookConfig{URL: server.URL, MaxAttempts: 2})
+			if err := w.deliver(context.Background(), WebhookEvent{Type: WebhookOverride}); err == nil {
+				t.Fatal("deliver succeeded")
+			}
+			if got := requests.Load(); got != tt.attempts {
+				t.Errorf("sent %d requests, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestWebhookDeadLettersQueueOnShutdown(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	deadLetterFile := filepath.Join(t.TempDir(), "dead.jsonl")
+	w := newTestWebhook(t, WebhookConfig{URL: server.URL, DeadLetterFile: deadLetterFile})
+	w.fire(WebhookEvent{Type: WebhookOverride})
+	w.fire(WebhookEvent{Type: WebhookBridgeDisconnected})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.run(ctx)
+
+	reasons := deadLetters(t, deadLetterFile)
+	if int(requests.Load())+len(reasons) != 2 {
+		t.Fatalf("sent %d and dead-lettered %v, want every event accounted for", requests.Load(), reasons)
+	}
+	for _, r := range reasons {
+		if r != context.Canceled.Error() {
+			t.Errorf("dead-lettered with %q, want %q", r, context.Canceled)
+		}
+	}
+	if len(w.queue) != 0 {
+		t.Errorf("%d events left in the queue", len(w.queue))
+	}
+}
+
+func TestBridgeDisconnectWebhook(t *testing.T) {
+	tl := newTestTimelight(Config{})
+	w := newTestWebhook(t, WebhookConfig{URL: "http://localhost"})
+	tl.webhooks = []*webhook{w}
+	hooks := tl.hueHooks()
+	lost := errors.New("connection refused")
+
+	// Failing to reconnect to an unreachable bridge fires nothing.
+	hooks.Disconnect(lost)
+	hooks.Disconnect(lost)
+	if n := len(w.queue); n != 0 {
+		t.Fatalf("%d events queued before ever connecting, want none", n)
+	}
+
+	hooks.Connect()
+	hooks.Disconnect(lost)
+	hooks.Disconnect(lost)
+	var types []string
+	for len(w.queue) > 0 {
+		types = append(types, (<-w.queue).Type)
+	}
+	want := []string{WebhookBridgeConnected, WebhookBridgeDisconnected}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("fired %v, want %v", types, want)
+	}
+}